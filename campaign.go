@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"game/sim"
+)
+
+// -- campaign
+
+const (
+	campaignManifestPath = "assets/campaign.json"
+	configDirName        = "office-escape"
+	progressFileName     = "progress.json"
+)
+
+// Campaign is the ordered list of levels and how far the player has got through them
+type Campaign struct {
+	levels       []string        // level file paths within the assets
+	levelFiles   []sim.LevelFile // metadata for the level select menu
+	progress     CampaignProgress
+	progressPath string // empty when progress can't be saved
+}
+
+type CampaignProgress struct {
+	Unlocked  int                `json:"unlocked"`  // number of levels that can be played
+	BestTimes map[string]float64 `json:"bestTimes"` // seconds, by level file path
+}
+
+type campaignManifest struct {
+	Levels []string `json:"levels"` // relative to the manifest
+}
+
+// load the levels listed in the manifest, or every level-N.json in the assets if there isn't one,
+// and the player's progress from their config directory
+func LoadCampaign(fsys fs.FS) (*Campaign, error) {
+	levels, err := campaignLevels(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if len(levels) == 0 {
+		return nil, errors.New("campaign has no levels")
+	}
+
+	c := &Campaign{
+		levels: levels,
+		progress: CampaignProgress{
+			Unlocked:  1,
+			BestTimes: make(map[string]float64),
+		},
+	}
+
+	for _, levelPath := range levels {
+		levelFile, err := sim.LoadLevelFile(fsys, levelPath)
+		if err != nil {
+			return nil, err
+		}
+		c.levelFiles = append(c.levelFiles, levelFile)
+	}
+
+	if dir, err := configDir(); err == nil {
+		c.progressPath = filepath.Join(dir, progressFileName)
+		c.loadProgress()
+	}
+
+	return c, nil
+}
+
+func campaignLevels(fsys fs.FS) ([]string, error) {
+	data, err := fs.ReadFile(fsys, campaignManifestPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return discoverLevels(fsys)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest campaignManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", campaignManifestPath, err)
+	}
+
+	levels := make([]string, len(manifest.Levels))
+	for i, level := range manifest.Levels {
+		levels[i] = path.Join(path.Dir(campaignManifestPath), level)
+	}
+	return levels, nil
+}
+
+// every assets/level-N.json, ordered by N
+func discoverLevels(fsys fs.FS) ([]string, error) {
+	levels, err := fs.Glob(fsys, "assets/level-*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	number := func(levelPath string) int {
+		n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path.Base(levelPath), "level-"), ".json"))
+		return n
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return number(levels[i]) < number(levels[j])
+	})
+	return levels, nil
+}
+
+// where a level file comes in the campaign, or -1 if it isn't one of its levels
+func (c *Campaign) levelIndex(levelPath string) int {
+	for i, p := range c.levels {
+		if p == levelPath {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Campaign) isUnlocked(index int) bool {
+	return index < c.progress.Unlocked
+}
+
+func (c *Campaign) bestTime(index int) (float64, bool) {
+	seconds, ok := c.progress.BestTimes[c.levels[index]]
+	return seconds, ok
+}
+
+// record a finished level, keeping the best time and unlocking the next level
+func (c *Campaign) completeLevel(index int, seconds float64) {
+	if best, ok := c.bestTime(index); !ok || seconds < best {
+		c.progress.BestTimes[c.levels[index]] = seconds
+	}
+	if index+2 > c.progress.Unlocked {
+		c.progress.Unlocked = index + 2
+	}
+	if c.progress.Unlocked > len(c.levels) {
+		c.progress.Unlocked = len(c.levels)
+	}
+	c.saveProgress()
+}
+
+// missing or unreadable progress just means starting from the first level
+func (c *Campaign) loadProgress() {
+	data, err := os.ReadFile(c.progressPath)
+	if err != nil {
+		return
+	}
+
+	var progress CampaignProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return
+	}
+	// the campaign may have lost levels since the progress was saved
+	if progress.Unlocked > c.progress.Unlocked {
+		c.progress.Unlocked = progress.Unlocked
+	}
+	if c.progress.Unlocked > len(c.levels) {
+		c.progress.Unlocked = len(c.levels)
+	}
+	for level, seconds := range progress.BestTimes {
+		c.progress.BestTimes[level] = seconds
+	}
+}
+
+func (c *Campaign) saveProgress() {
+	if c.progressPath == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(c.progress, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.progressPath), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(c.progressPath, data, 0o644)
+	}
+	if err != nil {
+		log.Printf("failed to save progress: %v", err)
+	}
+}
+
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDirName), nil
+}
@@ -5,32 +5,57 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"io/fs"
 	"log"
 	"math"
 	"os"
+	"runtime"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/colorm"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"game/raycast"
+	"game/sim"
 )
 
 //go:embed assets/*
 var assets embed.FS
 
 const (
-	screenWidth  int = 1024
-	screenHeight int = 768
+	windowWidth  int = 1024 // starting window size, it can be resized or made fullscreen
+	windowHeight int = 768
 )
 
 func main() {
-	ebiten.SetWindowSize(screenWidth, screenHeight)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		}
+	}
+
+	runGame(NewGame())
+}
+
+func runGame(g *Game) {
+	ebiten.SetWindowSize(windowWidth, windowHeight)
 	ebiten.SetWindowTitle("office escape!")
-	ebiten.SetCursorMode(ebiten.CursorModeCaptured)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	ebiten.SetWindowSizeLimits(320, 200, -1, -1)
+	// closing the window mid-level keeps the run, to continue from the title next time
+	ebiten.SetWindowClosingHandled(true)
 
-	if err := ebiten.RunGame(NewGame()); err != nil {
+	// update once per frame, the simulation keeps its own fixed timestep
+	ebiten.SetTPS(ebiten.SyncWithFPS)
+
+	if err := ebiten.RunGame(g); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -38,41 +63,54 @@ func main() {
 // -- rendering
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	if g.gameOver {
+	switch g.state {
+	case GameState_Title:
+		g.drawTitle(screen)
+	case GameState_Playing:
+		g.drawPlaying(screen)
+	case GameState_Paused:
+		g.drawPaused(screen)
+	case GameState_LevelComplete:
+		g.drawLevelComplete(screen)
+	case GameState_GameOver:
 		g.drawGameOver(screen)
-		return
-	}
-
-	// reset zbuffer
-	for i := range g.zBuffer {
-		g.zBuffer[i] = math.Inf(1)
-	}
-
-	// draw floor and ceiling
-	floorColor := color.RGBA{30, 30, 30, 255}
-	ceilingColor := color.RGBA{160, 227, 254, 255}
-	horizon := screenHeight/2 + int(float64(screenHeight)*math.Tan(g.player.verticalAngle))
-	for y := 0; y < screenHeight; y++ {
-		if y < horizon {
-			vector.DrawFilledRect(screen, 0, float32(y), float32(screenWidth), 1, ceilingColor, false)
-		} else {
-			vector.DrawFilledRect(screen, 0, float32(y), float32(screenWidth), 1, floorColor, false)
-		}
+	case GameState_Settings:
+		g.drawSettings(screen)
+	case GameState_LevelSelect:
+		g.drawLevelSelect(screen)
+	case GameState_Replay:
+		g.drawReplay(screen)
 	}
+}
 
-	var drawables []Drawable // all drawable entities
+func (g *Game) drawPlaying(screen *ebiten.Image) {
+	g.drawView(screen)
+	g.drawDynamicMinimap(screen)
+	g.drawUI(screen)
+}
 
-	// collect walls and constructs
-	for x := 0; x < screenWidth; x++ {
-		rayDirX, rayDirY := g.calculateRayDirection(x)
-		entities := g.castRay(x, rayDirX, rayDirY)
-		for _, entity := range entities {
+// draw the 3d view at the render resolution, then scale it up to fit the screen with
+// nearest-neighbour filtering so low resolutions stay crisp
+func (g *Game) drawView(screen *ebiten.Image) {
+	frame := g.renderFrame()
+	g.drawFloorAndCeiling(frame)
+
+	// cast the rays for every column, then collect walls and constructs
+	g.caster.Cast(g.world, playerCamera(g.view.player))
+	drawables := g.drawables[:0]
+	for x := 0; x < g.caster.Width(); x++ {
+		for _, hit := range g.caster.Column(x) {
 			drawables = append(drawables, Drawable{
 				entityType: entityTypeWallOrConstruct,
 				x:          x,
-				dist:       entity.dist,
-				entity:     entity.entity,
-				side:       entity.side,
+				dist:       hit.Dist,
+				entity:     hit.Entity,
+				side:       hit.Side,
+				wallX:      hit.WallX,
+				tileX:      hit.TileX,
+				tileY:      hit.TileY,
+				light:      g.world.LightMap.At(hit.FaceX, hit.FaceY),
+				height:     g.world.Level.TileAt(hit.TileX, hit.TileY).Height,
 			})
 		}
 	}
@@ -83,35 +121,213 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	// collect coins
 	drawables = g.collectCoins(drawables)
 
+	// collect pickups
+	drawables = g.collectPickups(drawables)
+
 	// sort drawables by distance (furthest first)
-	sort.Slice(drawables, func(i, j int) bool {
-		return drawables[i].dist > drawables[j].dist
-	})
+	sort.Sort(byDistance(drawables))
+	g.drawables = drawables
 
 	// draw all entities in order
 	for _, d := range drawables {
 		switch d.entityType {
 		case entityTypeWallOrConstruct:
-			g.drawWallOrConstruct(screen, d.x, d.dist, d.entity, d.side)
+			g.drawWallOrConstruct(frame, d)
 		case entityTypeEnemy:
-			g.drawEnemy(screen, d)
+			g.drawEnemy(frame, d)
 		case entityTypeCoin:
-			g.drawCoin(screen, d)
+			g.drawCoin(frame, d)
+		case entityTypePickup:
+			g.drawPickup(frame, d)
 		}
 	}
 
-	g.drawDynamicMinimap(screen)
-	g.drawUI(screen)
+	// letterbox rather than stretch when the window's shape doesn't match the resolution
+	frameWidth, frameHeight := g.frameSize()
+	screenWidth, screenHeight := screen.Bounds().Dx(), screen.Bounds().Dy()
+	scale := math.Min(float64(screenWidth)/float64(frameWidth), float64(screenHeight)/float64(frameHeight))
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterNearest}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate((float64(screenWidth)-float64(frameWidth)*scale)/2, (float64(screenHeight)-float64(frameHeight)*scale)/2)
+	screen.DrawImage(frame, op)
+}
+
+// the image the 3d view is drawn to, made again along with the ray caster whenever the
+// render resolution changes
+func (g *Game) renderFrame() *ebiten.Image {
+	resolution := g.settings.renderResolution()
+	if width, height := g.frameSize(); width != resolution.width || height != resolution.height {
+		g.frame.Deallocate()
+		g.frame = ebiten.NewImage(resolution.width, resolution.height)
+		g.caster.Close()
+		g.caster = raycast.NewCaster(resolution.width, runtime.GOMAXPROCS(0))
+	}
+	return g.frame
+}
+
+// size of the 3d view in pixels
+func (g *Game) frameSize() (int, int) {
+	return g.frame.Bounds().Dx(), g.frame.Bounds().Dy()
+}
+
+// pixels tall a tile of height appears one tile away. the view is as tall as a 4:3 one of the
+// same width, so wider resolutions see less above and below instead of stretching
+func (g *Game) projectionScale() float64 {
+	width, _ := g.frameSize()
+	return float64(width) * 3 / 4
+}
+
+// cast the floor and ceiling one screen row at a time. every pixel in a row is the same
+// distance away, so the texture coordinates along a row are linear and each row can be
+// drawn as a single repeating textured quad.
+func (g *Game) drawFloorAndCeiling(screen *ebiten.Image) {
+	width, height := g.frameSize()
+	scale := g.projectionScale()
+	horizon := float64(height/2 + int(scale*math.Tan(g.view.player.VerticalAngle)))
+
+	// eye height above the floor and below the ceiling, in tiles, matching calculateLineBounds
+	eyeHeight := 1 - g.view.player.HeightOffset
+	ceilingHeight := sim.DefaultTileProperties(sim.LevelEntity_Wall).Height - eyeHeight
+
+	// rays through the leftmost and rightmost columns
+	leftDirX, leftDirY := g.view.player.DirX-g.view.player.PlaneX, g.view.player.DirY-g.view.player.PlaneY
+	rightDirX, rightDirY := g.view.player.DirX+g.view.player.PlaneX, g.view.player.DirY+g.view.player.PlaneY
+
+	g.floorRows.reset()
+	g.ceilingRows.reset()
+	g.lightRows.reset()
+	g.fogRows.reset()
+	fogR, fogG, fogB := float32(g.fog.Color[0])/255, float32(g.fog.Color[1])/255, float32(g.fog.Color[2])/255
+
+	for y := 0; y < height; y++ {
+		// sample the middle of the row so the row at the horizon never divides by zero
+		rowY := float64(y) + 0.5
+
+		isFloor := rowY > horizon
+		var rowDistance float64
+		var texture *ebiten.Image
+		if isFloor {
+			rowDistance = scale * eyeHeight / (rowY - horizon)
+			texture = g.floorTexture
+		} else {
+			rowDistance = scale * ceilingHeight / (horizon - rowY)
+			texture = g.ceilingTexture
+		}
+
+		// where the row's ends meet the floor or ceiling, in tiles
+		worldLeftX, worldLeftY := float32(g.view.player.X+rowDistance*leftDirX), float32(g.view.player.Y+rowDistance*leftDirY)
+		worldRightX, worldRightY := float32(g.view.player.X+rowDistance*rightDirX), float32(g.view.player.Y+rowDistance*rightDirY)
+
+		texWidth, texHeight := float32(texture.Bounds().Dx()), float32(texture.Bounds().Dy())
+		leftX, leftY := worldLeftX*texWidth, worldLeftY*texHeight
+		rightX, rightY := worldRightX*texWidth, worldRightY*texHeight
+
+		quad := [4]ebiten.Vertex{
+			{DstX: 0, DstY: float32(y), SrcX: leftX, SrcY: leftY, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+			{DstX: float32(width), DstY: float32(y), SrcX: rightX, SrcY: rightY, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+			{DstX: 0, DstY: float32(y + 1), SrcX: leftX, SrcY: leftY, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+			{DstX: float32(width), DstY: float32(y + 1), SrcX: rightX, SrcY: rightY, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+		}
+
+		if isFloor {
+			g.floorRows.addQuad(quad)
+		} else {
+			g.ceilingRows.addQuad(quad)
+		}
+
+		// the light map has one pixel per tile, so it's addressed in tiles rather than texels
+		g.lightRows.addQuad([4]ebiten.Vertex{
+			{DstX: 0, DstY: float32(y), SrcX: worldLeftX, SrcY: worldLeftY, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+			{DstX: float32(width), DstY: float32(y), SrcX: worldRightX, SrcY: worldRightY, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+			{DstX: 0, DstY: float32(y + 1), SrcX: worldLeftX, SrcY: worldLeftY, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+			{DstX: float32(width), DstY: float32(y + 1), SrcX: worldRightX, SrcY: worldRightY, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+		})
+
+		// the whole row is the same distance away, so it's evenly covered by the fog
+		if amount := float32(g.fogAmount(rowDistance)); amount > 0 {
+			g.fogRows.addQuad([4]ebiten.Vertex{
+				{DstX: 0, DstY: float32(y), SrcX: 1, SrcY: 1, ColorR: fogR, ColorG: fogG, ColorB: fogB, ColorA: amount},
+				{DstX: float32(width), DstY: float32(y), SrcX: 1, SrcY: 1, ColorR: fogR, ColorG: fogG, ColorB: fogB, ColorA: amount},
+				{DstX: 0, DstY: float32(y + 1), SrcX: 1, SrcY: 1, ColorR: fogR, ColorG: fogG, ColorB: fogB, ColorA: amount},
+				{DstX: float32(width), DstY: float32(y + 1), SrcX: 1, SrcY: 1, ColorR: fogR, ColorG: fogG, ColorB: fogB, ColorA: amount},
+			})
+		}
+	}
+
+	op := &ebiten.DrawTrianglesOptions{Address: ebiten.AddressRepeat}
+	screen.DrawTriangles(g.floorRows.vertices, g.floorRows.indices, g.floorTexture, op)
+	screen.DrawTriangles(g.ceilingRows.vertices, g.ceilingRows.indices, g.ceilingTexture, op)
+
+	// multiply by the light map, blending between tiles so light falls off smoothly
+	g.updateLightImage()
+	screen.DrawTriangles(g.lightRows.vertices, g.lightRows.indices, g.lightImage, &ebiten.DrawTrianglesOptions{
+		Filter:  ebiten.FilterLinear,
+		Address: ebiten.AddressClampToZero,
+		Blend:   multiplyBlend,
+	})
+
+	screen.DrawTriangles(g.fogRows.vertices, g.fogRows.indices, emptySubImage, nil)
+}
+
+// the vertices and indices for one DrawTriangles call, kept between frames so they're only
+// allocated again when the view grows
+type triangleBatch struct {
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+// empty the batch, keeping its storage
+func (b *triangleBatch) reset() {
+	b.vertices, b.indices = b.vertices[:0], b.indices[:0]
+}
+
+// add a quad from its top left, top right, bottom left and bottom right corners
+func (b *triangleBatch) addQuad(quad [4]ebiten.Vertex) {
+	base := uint16(len(b.vertices))
+	b.vertices = append(b.vertices, quad[:]...)
+	b.indices = append(b.indices, base, base+1, base+2, base+1, base+3, base+2)
+}
+
+// the destination multiplied by the source
+var multiplyBlend = ebiten.Blend{
+	BlendFactorSourceRGB:        ebiten.BlendFactorZero,
+	BlendFactorSourceAlpha:      ebiten.BlendFactorZero,
+	BlendFactorDestinationRGB:   ebiten.BlendFactorSourceColor,
+	BlendFactorDestinationAlpha: ebiten.BlendFactorOne,
+	BlendOperationRGB:           ebiten.BlendOperationAdd,
+	BlendOperationAlpha:         ebiten.BlendOperationAdd,
+}
+
+// copy the world's light map into the image the floor and ceiling are shaded with. walls take
+// the light of their brightest open neighbour so they don't cast a dark edge onto the floor
+func (g *Game) updateLightImage() {
+	level := g.world.Level
+	for y := 0; y < level.Height(); y++ {
+		for x := 0; x < level.Width(); x++ {
+			light := g.world.LightMap.At(x, y)
+			if !level.TileAt(x, y).SeeThrough {
+				light = 0
+				for _, n := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+					if level.InBounds(x+n[0], y+n[1]) && level.TileAt(x+n[0], y+n[1]).SeeThrough {
+						light = math.Max(light, g.world.LightMap.At(x+n[0], y+n[1]))
+					}
+				}
+			}
+			i := (y*level.Width() + x) * 4
+			g.lightPixels[i], g.lightPixels[i+1], g.lightPixels[i+2], g.lightPixels[i+3] = uint8(255*light), uint8(255*light), uint8(255*light), 255
+		}
+	}
+	g.lightImage.WritePixels(g.lightPixels)
 }
 
 func (g *Game) collectEnemies(drawables []Drawable) []Drawable {
-	for i := range g.enemies {
-		enemy := &g.enemies[i]
-		spriteX := enemy.x - g.player.x
-		spriteY := enemy.y - g.player.y
+	for i := range g.view.enemies {
+		enemy := &g.view.enemies[i]
+		spriteX := enemy.X - g.view.player.X
+		spriteY := enemy.Y - g.view.player.Y
 		inverseDeterminant := g.calculateSpriteInverseDeterminant()
 		transformX, transformY := g.calculateSpriteTransform(inverseDeterminant, spriteX, spriteY)
-		spriteScreenX := calculateSpriteScreenX(transformX, transformY)
+		spriteScreenX := g.calculateSpriteScreenX(transformX, transformY)
 
 		drawables = append(drawables, Drawable{
 			entityType:    entityTypeEnemy,
@@ -120,19 +336,21 @@ func (g *Game) collectEnemies(drawables []Drawable) []Drawable {
 			enemy:         enemy,
 			spriteScreenX: spriteScreenX,
 			transformY:    transformY,
+			light:         g.world.LightMap.At(int(enemy.X), int(enemy.Y)),
 		})
 	}
 	return drawables
 }
 
 func (g *Game) collectCoins(drawables []Drawable) []Drawable {
+	coins := g.view.coins
 	for i := range coins {
 		coin := &coins[i]
-		spriteX := coin.x - g.player.x
-		spriteY := coin.y - g.player.y
+		spriteX := coin.X - g.view.player.X
+		spriteY := coin.Y - g.view.player.Y
 		inverseDeterminant := g.calculateSpriteInverseDeterminant()
 		transformX, transformY := g.calculateSpriteTransform(inverseDeterminant, spriteX, spriteY)
-		spriteScreenX := calculateSpriteScreenX(transformX, transformY)
+		spriteScreenX := g.calculateSpriteScreenX(transformX, transformY)
 
 		drawables = append(drawables, Drawable{
 			entityType:    entityTypeCoin,
@@ -141,24 +359,48 @@ func (g *Game) collectCoins(drawables []Drawable) []Drawable {
 			coin:          coin,
 			spriteScreenX: spriteScreenX,
 			transformY:    transformY,
+			light:         g.world.LightMap.At(int(coin.X), int(coin.Y)),
+		})
+	}
+	return drawables
+}
+
+func (g *Game) collectPickups(drawables []Drawable) []Drawable {
+	for i := range g.world.Pickups {
+		pickup := &g.world.Pickups[i]
+		spriteX := pickup.X - g.view.player.X
+		spriteY := pickup.Y - g.view.player.Y
+		inverseDeterminant := g.calculateSpriteInverseDeterminant()
+		transformX, transformY := g.calculateSpriteTransform(inverseDeterminant, spriteX, spriteY)
+		spriteScreenX := g.calculateSpriteScreenX(transformX, transformY)
+
+		drawables = append(drawables, Drawable{
+			entityType:    entityTypePickup,
+			x:             spriteScreenX,
+			dist:          transformY,
+			pickup:        pickup,
+			spriteScreenX: spriteScreenX,
+			transformY:    transformY,
+			light:         g.world.LightMap.At(int(pickup.X), int(pickup.Y)),
 		})
 	}
 	return drawables
 }
 
-func calculateSpriteScreenX(transformX float64, transformY float64) int {
-	spriteScreenX := int((float64(screenWidth) / 2) * (1 + transformX/transformY))
+func (g *Game) calculateSpriteScreenX(transformX float64, transformY float64) int {
+	width, _ := g.frameSize()
+	spriteScreenX := int((float64(width) / 2) * (1 + transformX/transformY))
 	return spriteScreenX
 }
 
 func (g *Game) calculateSpriteTransform(invDet float64, spriteX float64, spriteY float64) (float64, float64) {
-	transformX := invDet * (g.player.dirY*spriteX - g.player.dirX*spriteY)
-	transformY := invDet * (-g.player.planeY*spriteX + g.player.planeX*spriteY)
+	transformX := invDet * (g.view.player.DirY*spriteX - g.view.player.DirX*spriteY)
+	transformY := invDet * (-g.view.player.PlaneY*spriteX + g.view.player.PlaneX*spriteY)
 	return transformX, transformY
 }
 
 func (g *Game) calculateSpriteInverseDeterminant() float64 {
-	invDet := 1.0 / (g.player.planeX*g.player.dirY - g.player.dirX*g.player.planeY)
+	invDet := 1.0 / (g.view.player.PlaneX*g.view.player.DirY - g.view.player.DirX*g.view.player.PlaneY)
 	return invDet
 }
 
@@ -168,20 +410,38 @@ const (
 	entityTypeWallOrConstruct EntityType = iota
 	entityTypeEnemy
 	entityTypeCoin
+	entityTypePickup
 )
 
 type Drawable struct {
 	entityType    EntityType
 	x             int
 	dist          float64
-	entity        LevelEntity
+	entity        sim.LevelEntity
 	side          int
-	enemy         *Enemy
-	coin          *Coin
+	wallX         float64 // where the ray hit the tile face, in [0, 1)
+	tileX, tileY  int     // the tile a wall or construct column is part of
+	light         float64 // from the light map, in front of a wall's face or under a sprite
+	height        float64 // tiles, of a wall or construct column
+	enemy         *sim.Enemy
+	coin          *sim.Coin
+	pickup        *sim.Pickup
 	spriteScreenX int
 	transformY    float64
 }
 
+// drawables sorted furthest first
+type byDistance []Drawable
+
+func (d byDistance) Len() int           { return len(d) }
+func (d byDistance) Less(i, j int) bool { return d[i].dist > d[j].dist }
+func (d byDistance) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// the ray casting camera for the player's view
+func playerCamera(p sim.Player) raycast.Camera {
+	return raycast.Camera{X: p.X, Y: p.Y, DirX: p.DirX, DirY: p.DirY, PlaneX: p.PlaneX, PlaneY: p.PlaneY}
+}
+
 type SpriteParameters struct {
 	spriteScreenX int
 	transformY    float64
@@ -202,131 +462,57 @@ type SpriteVisiblePortion struct {
 	drawEndX      int
 }
 
-func (g *Game) calculateRayDirection(x int) (float64, float64) {
-	cameraX := 2*float64(x)/float64(screenWidth) - 1
-	rayDirX := g.player.dirX + g.player.planeX*cameraX
-	rayDirY := g.player.dirY + g.player.planeY*cameraX
-	return rayDirX, rayDirY
-}
-
-func (g *Game) castRay(x int, rayDirX, rayDirY float64) []struct {
-	entity LevelEntity
-	dist   float64
-	side   int
-} {
-	mapX, mapY := int(g.player.x), int(g.player.y)
-	var sideDistX, sideDistY float64
-	deltaDistX := math.Abs(1 / rayDirX)
-	deltaDistY := math.Abs(1 / rayDirY)
-	var stepX, stepY int
-	var side int
-
-	if rayDirX < 0 {
-		stepX = -1
-		sideDistX = (g.player.x - float64(mapX)) * deltaDistX
-	} else {
-		stepX = 1
-		sideDistX = (float64(mapX) + 1.0 - g.player.x) * deltaDistX
-	}
-	if rayDirY < 0 {
-		stepY = -1
-		sideDistY = (g.player.y - float64(mapY)) * deltaDistY
-	} else {
-		stepY = 1
-		sideDistY = (float64(mapY) + 1.0 - g.player.y) * deltaDistY
-	}
-
-	var hitWall bool
-	var entities []struct {
-		entity LevelEntity
-		dist   float64
-		side   int
-	}
-
-	for !hitWall {
-		if sideDistX < sideDistY {
-			sideDistX += deltaDistX
-			mapX += stepX
-			side = 0
-		} else {
-			sideDistY += deltaDistY
-			mapY += stepY
-			side = 1
-		}
-		hitEntity := g.level.getEntityAt(mapX, mapY)
-		if hitEntity != LevelEntity_Empty {
-			var dist float64
-			if side == 0 {
-				dist = (float64(mapX) - g.player.x + (1-float64(stepX))/2) / rayDirX
-			} else {
-				dist = (float64(mapY) - g.player.y + (1-float64(stepY))/2) / rayDirY
-			}
+// unclamped bounds of a column tileHeight tiles tall, drawStart may be above the screen and
+// drawEnd below it
+func (g *Game) calculateLineBounds(dist, tileHeight float64) (int, int, int) {
+	_, height := g.frameSize()
+	scale := g.projectionScale()
+	lineHeight := int(scale / dist)
 
-			// update zbuffer
-			g.zBuffer[x] = dist
+	// adjust the vertical position based on player height and vertical angle
+	verticalOffset := int(scale * math.Tan(g.view.player.VerticalAngle))
+	heightOffset := int((0.5-g.view.player.HeightOffset)*scale/dist) + verticalOffset
 
-			entities = append(entities, struct {
-				entity LevelEntity
-				dist   float64
-				side   int
-			}{hitEntity, dist, side})
+	drawEnd := lineHeight/2 + height/2 + heightOffset
 
-			if hitEntity == LevelEntity_Wall {
-				hitWall = true
-			}
-		}
-	}
+	// make walls taller and constructs shorter, growing up from the floor
+	lineHeight = int(float64(lineHeight) * tileHeight)
+	drawStart := drawEnd - lineHeight
 
-	return entities
+	return lineHeight, drawStart, drawEnd
 }
 
-func (g *Game) calculateLineParameters(dist float64, entity LevelEntity) (int, int, int) {
-	lineHeight := int(float64(screenHeight) / dist)
-
-	// adjust the vertical position based on player height and vertical angle
-	verticalOffset := int(float64(screenHeight) * math.Tan(g.player.verticalAngle))
-	heightOffset := int((0.5-g.player.heightOffset)*float64(screenHeight)/dist) + verticalOffset
-
-	drawStart := -lineHeight/2 + screenHeight/2 + heightOffset
-	drawEnd := lineHeight/2 + screenHeight/2 + heightOffset
-
-	// make walls taller
-	if entity == LevelEntity_Wall {
-		factor := 2.0
-		lineHeight = int(float64(lineHeight) * factor)
-		drawStart = drawEnd - lineHeight
-	}
-
-	// make constructs shorter
-	if entity == LevelEntity_Construct {
-		factor := 0.8
-		lineHeight = int(float64(lineHeight) * factor)
-		drawStart = drawEnd - lineHeight
-	}
+func (g *Game) calculateLineParameters(dist, tileHeight float64) (int, int, int) {
+	lineHeight, drawStart, drawEnd := g.calculateLineBounds(dist, tileHeight)
 
+	_, height := g.frameSize()
 	if drawStart < 0 {
 		drawStart = 0
 	}
-	if drawEnd >= screenHeight {
-		drawEnd = screenHeight - 1
+	if drawEnd >= height {
+		drawEnd = height - 1
 	}
 
 	return lineHeight, drawStart, drawEnd
 }
 
-func (g *Game) getEntityColor(entity LevelEntity, side int) color.RGBA {
+func (g *Game) getEntityColor(entity sim.LevelEntity, side int) color.RGBA {
 	var entityColor color.RGBA
 	switch entity {
-	case LevelEntity_Wall:
+	case sim.LevelEntity_Wall:
 		entityColor = color.RGBA{100, 100, 100, 255}
-	case LevelEntity_Enemy:
+	case sim.LevelEntity_Enemy:
 		entityColor = color.RGBA{198, 54, 54, 255}
-	case LevelEntity_Exit:
+	case sim.LevelEntity_Exit:
 		entityColor = color.RGBA{255, 255, 0, 255}
-	case LevelEntity_Player:
+	case sim.LevelEntity_Player:
 		entityColor = color.RGBA{0, 255, 0, 255}
-	case LevelEntity_Construct:
+	case sim.LevelEntity_Construct:
 		entityColor = color.RGBA{150, 50, 200, 255}
+	case sim.LevelEntity_Door:
+		entityColor = color.RGBA{150, 100, 50, 255}
+	case sim.LevelEntity_Glass:
+		entityColor = color.RGBA{170, 215, 235, 255}
 	default:
 		entityColor = color.RGBA{200, 200, 200, 255}
 	}
@@ -340,10 +526,146 @@ func (g *Game) getEntityColor(entity LevelEntity, side int) color.RGBA {
 	return entityColor
 }
 
-func (g *Game) drawWallOrConstruct(screen *ebiten.Image, x int, dist float64, entity LevelEntity, side int) {
-	_, drawStart, drawEnd := g.calculateLineParameters(dist, entity)
-	wallColor := g.getEntityColor(entity, side)
-	vector.DrawFilledRect(screen, float32(x), float32(drawStart), 1, float32(drawEnd-drawStart), wallColor, false)
+func (g *Game) drawWallOrConstruct(screen *ebiten.Image, d Drawable) {
+	x, dist, entity, side, wallX := d.x, d.dist, d.entity, d.side, d.wallX
+
+	if entity == sim.LevelEntity_Glass {
+		g.drawGlass(screen, d)
+		return
+	}
+
+	texture, ok := g.wallTextures[entity]
+	if !ok {
+		_, drawStart, drawEnd := g.calculateLineParameters(dist, d.height)
+		wallColor := g.fogColor(shadeColor(g.getEntityColor(entity, side), d.light), dist)
+		vector.DrawFilledRect(screen, float32(x), float32(drawStart), 1, float32(drawEnd-drawStart), wallColor, false)
+		return
+	}
+
+	// offscreen parts are clipped when drawing, so use the unclamped bounds
+	_, _, drawEnd := g.calculateLineBounds(dist, d.height)
+	tileHeight := g.projectionScale() / dist
+
+	texWidth, texHeight := texture.Bounds().Dx(), texture.Bounds().Dy()
+	texX := int(wallX * float64(texWidth))
+	if texX >= texWidth {
+		texX = texWidth - 1
+	}
+
+	tint := g.getTextureTint(entity, side)
+
+	// stack one copy of the texture per tile of height from the floor up, cropping the top one
+	bottom := float64(drawEnd)
+	for remaining := d.height; remaining > 0; remaining-- {
+		part := math.Min(remaining, 1)
+		texStartY := int(float64(texHeight) * (1 - part))
+		column := texture.SubImage(image.Rect(texX, texStartY, texX+1, texHeight)).(*ebiten.Image)
+
+		segmentHeight := tileHeight * part
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(1, segmentHeight/float64(texHeight-texStartY))
+		op.GeoM.Translate(float64(x), bottom-segmentHeight)
+		op.ColorScale.ScaleWithColor(tint)
+		op.ColorScale.Scale(float32(d.light), float32(d.light), float32(d.light), 1)
+		screen.DrawImage(column, op)
+
+		bottom -= segmentHeight
+	}
+
+	// light switches and the keycard readers on locked doors are small plates a little above
+	// head height in the middle of the face, glowing a little so they can be found in the dark
+	if math.Abs(wallX-0.5) < plateWidth/2 {
+		var plateColor color.RGBA
+		if i := g.world.SwitchAt(d.tileX, d.tileY); i >= 0 {
+			plateColor = color.RGBA{200, 60, 40, 255}
+			if g.world.Switches[i].On {
+				plateColor = color.RGBA{90, 210, 90, 255}
+			}
+		} else if door := g.world.DoorAt(d.tileX, d.tileY); door != nil && door.Keycard != "" {
+			plateColor = sim.KeycardColors[door.Keycard]
+		}
+		if plateColor.A > 0 {
+			plateColor = shadeColor(plateColor, math.Max(d.light, plateGlow))
+			plateTop := float64(drawEnd) - plateTopHeight*tileHeight
+			vector.DrawFilledRect(screen, float32(x), float32(plateTop), 1, float32(plateHeight*tileHeight), plateColor, false)
+		}
+	}
+
+	// walls are opaque, so the fog can simply be laid over the whole column
+	if fog := g.fogOverlay(dist); fog.A > 0 {
+		vector.DrawFilledRect(screen, float32(x), float32(bottom), 1, float32(float64(drawEnd)-bottom), fog, false)
+	}
+}
+
+const (
+	glassOpacity  float64 = 0.3
+	glassFrame    float64 = 0.04 // of a tile, the opaque frame at either edge of a pane
+	glassFrameTop float64 = 1.0  // tiles above the floor of the transom across the middle
+)
+
+// glass is drawn over whatever the ray saw behind it, which has been drawn already since
+// drawables go furthest first
+func (g *Game) drawGlass(screen *ebiten.Image, d Drawable) {
+	_, drawStart, drawEnd := g.calculateLineParameters(d.dist, d.height)
+	frameColor := g.fogColor(shadeColor(g.getEntityColor(sim.LevelEntity_Wall, d.side), d.light), d.dist)
+
+	if d.wallX < glassFrame || d.wallX > 1-glassFrame {
+		vector.DrawFilledRect(screen, float32(d.x), float32(drawStart), 1, float32(drawEnd-drawStart), frameColor, false)
+		return
+	}
+
+	// colours are premultiplied, so a see-through one is scaled down along with its alpha
+	paneColor := g.fogColor(shadeColor(g.getEntityColor(d.entity, d.side), d.light), d.dist)
+	opacity := glassOpacity
+	pane := color.RGBA{uint8(float64(paneColor.R) * opacity), uint8(float64(paneColor.G) * opacity), uint8(float64(paneColor.B) * opacity), uint8(255 * opacity)}
+	vector.DrawFilledRect(screen, float32(d.x), float32(drawStart), 1, float32(drawEnd-drawStart), pane, false)
+
+	// a thin transom across the pane so it reads as glass rather than a tinted haze
+	_, _, floorY := g.calculateLineBounds(d.dist, d.height)
+	tileHeight := g.projectionScale() / d.dist
+	transomY := float64(floorY) - glassFrameTop*tileHeight
+	vector.DrawFilledRect(screen, float32(d.x), float32(transomY), 1, float32(math.Max(1, glassFrame*tileHeight)), frameColor, false)
+}
+
+const (
+	plateWidth     float64 = 0.16 // of a tile
+	plateHeight    float64 = 0.24
+	plateTopHeight float64 = 1.35 // tiles above the floor
+	plateGlow      float64 = 0.5  // lowest light a plate is shown in
+)
+
+// a flat colour in the given light, from 0 for pitch dark to 1 for fully lit
+func shadeColor(c color.RGBA, light float64) color.RGBA {
+	return color.RGBA{uint8(float64(c.R) * light), uint8(float64(c.G) * light), uint8(float64(c.B) * light), c.A}
+}
+
+// colour the texture is multiplied by, with y-sides darkened like the flat colours
+func (g *Game) getTextureTint(entity sim.LevelEntity, side int) color.RGBA {
+	tint := color.RGBA{255, 255, 255, 255}
+	if entity == sim.LevelEntity_Construct || entity == sim.LevelEntity_Door {
+		// constructs and doors share the wall texture, tinted halfway towards their flat colour
+		entityColor := g.getEntityColor(entity, 0)
+		tint.R = 255 - (255-entityColor.R)/2
+		tint.G = 255 - (255-entityColor.G)/2
+		tint.B = 255 - (255-entityColor.B)/2
+	}
+
+	if side == 1 {
+		tint.R = tint.R / 2
+		tint.G = tint.G / 2
+		tint.B = tint.B / 2
+	}
+
+	return tint
+}
+
+func loadWallTextures() map[sim.LevelEntity]*ebiten.Image {
+	wallTexture := loadImageAsset("wall.png")
+	return map[sim.LevelEntity]*ebiten.Image{
+		sim.LevelEntity_Wall:      wallTexture,
+		sim.LevelEntity_Construct: wallTexture,
+		sim.LevelEntity_Door:      wallTexture,
+	}
 }
 
 func (g *Game) drawEnemy(screen *ebiten.Image, d Drawable) {
@@ -351,22 +673,41 @@ func (g *Game) drawEnemy(screen *ebiten.Image, d Drawable) {
 	params := g.calculateSpriteParameters(d)
 
 	// determine which sprite to use based on enemy's orientation relative to player
-	enemyToPlayerX := g.player.x - enemy.x
-	enemyToPlayerY := g.player.y - enemy.y
+	enemyToPlayerX := g.view.player.X - enemy.X
+	enemyToPlayerY := g.view.player.Y - enemy.Y
 
 	angle := getNormalizedAngle(enemyToPlayerY, enemyToPlayerX, enemy)
 
 	enemySprite := g.getEnemySpriteForAngle(angle)
 
-	visiblePortion := getVisiblePortionOfSprite(enemySprite, params)
+	visiblePortion := g.getVisiblePortionOfSprite(enemySprite, params)
 
-	g.drawSprite(screen, enemySprite, params, visiblePortion)
+	g.drawSprite(screen, enemySprite, params, visiblePortion, d.light)
 }
 
 func (g *Game) drawCoin(screen *ebiten.Image, d Drawable) {
 	params := g.calculateSpriteParameters(d)
-	visiblePortion := getVisiblePortionOfSprite(coinSprite, params)
-	g.drawSprite(screen, coinSprite, params, visiblePortion)
+	visiblePortion := g.getVisiblePortionOfSprite(g.coinSprite, params)
+	g.drawSprite(screen, g.coinSprite, params, visiblePortion, d.light)
+}
+
+func (g *Game) drawPickup(screen *ebiten.Image, d Drawable) {
+	var sprite *ebiten.Image
+	switch d.pickup.Kind {
+	case sim.PickupKind_Keycard:
+		sprite = g.keycardSprites[d.pickup.Color]
+	case sim.PickupKind_Coins:
+		sprite = g.coinSprite
+	case sim.PickupKind_Disguise:
+		sprite = g.disguiseSprite
+	}
+	if sprite == nil {
+		return
+	}
+
+	params := g.calculateSpriteParameters(d)
+	visiblePortion := g.getVisiblePortionOfSprite(sprite, params)
+	g.drawSprite(screen, sprite, params, visiblePortion, d.light)
 }
 
 func (g *Game) getEnemySpriteForAngle(angle float64) *ebiten.Image {
@@ -395,24 +736,30 @@ func (g *Game) calculateSpriteParameters(d Drawable) SpriteParameters {
 		transformY:    d.transformY,
 	}
 
-	params.spriteHeight = int(math.Abs(float64(screenHeight) / params.transformY))
-	params.spriteWidth = int(math.Abs(float64(screenHeight) / params.transformY))
+	_, height := g.frameSize()
+	scale := g.projectionScale()
+	params.spriteHeight = int(math.Abs(scale / params.transformY))
+	params.spriteWidth = int(math.Abs(scale / params.transformY))
 
-	vMoveScreen := int(float64(params.spriteHeight) * (0.5 - g.player.heightOffset))
+	vMoveScreen := int(float64(params.spriteHeight) * (0.5 - g.view.player.HeightOffset))
 
-	params.drawStartY = -params.spriteHeight/2 + screenHeight/2 + vMoveScreen
-	params.drawEndY = params.spriteHeight/2 + screenHeight/2 + vMoveScreen
+	params.drawStartY = -params.spriteHeight/2 + height/2 + vMoveScreen
+	params.drawEndY = params.spriteHeight/2 + height/2 + vMoveScreen
 
-	if d.entityType == entityTypeCoin {
-		// coins don't need vertical movement or angle adjustments
-		params.drawStartY = -params.spriteHeight/2 + screenHeight/2
-		params.drawEndY = params.spriteHeight/2 + screenHeight/2
+	if d.entityType == entityTypeCoin || d.entityType == entityTypePickup {
+		// coins and pickups don't need vertical movement or angle adjustments, just lifting while in the air
+		lift := 0
+		if d.coin != nil {
+			lift = int(d.coin.Z * float64(params.spriteHeight))
+		}
+		params.drawStartY = -params.spriteHeight/2 + height/2 - lift
+		params.drawEndY = params.spriteHeight/2 + height/2 - lift
 	}
 
 	params.drawStartX = -params.spriteWidth/2 + params.spriteScreenX
 	params.drawEndX = params.spriteWidth/2 + params.spriteScreenX
 
-	verticalAngleOffset := int(float64(screenHeight) * math.Tan(g.player.verticalAngle))
+	verticalAngleOffset := int(scale * math.Tan(g.view.player.VerticalAngle))
 
 	params.drawStartY += verticalAngleOffset
 	params.drawEndY += verticalAngleOffset
@@ -420,22 +767,23 @@ func (g *Game) calculateSpriteParameters(d Drawable) SpriteParameters {
 	return params
 }
 
-func getVisiblePortionOfSprite(enemySprite *ebiten.Image, params SpriteParameters) SpriteVisiblePortion {
+func (g *Game) getVisiblePortionOfSprite(enemySprite *ebiten.Image, params SpriteParameters) SpriteVisiblePortion {
+	width, height := g.frameSize()
 	visibleStartY := 0
 	visibleEndY := enemySprite.Bounds().Dy()
 	if params.drawStartY < 0 {
 		visibleStartY = -params.drawStartY * enemySprite.Bounds().Dy() / params.spriteHeight
 		params.drawStartY = 0
 	}
-	if params.drawEndY >= screenHeight {
-		visibleEndY = (screenHeight - params.drawStartY) * enemySprite.Bounds().Dy() / params.spriteHeight
-		params.drawEndY = screenHeight - 1
+	if params.drawEndY >= height {
+		visibleEndY = (height - params.drawStartY) * enemySprite.Bounds().Dy() / params.spriteHeight
+		params.drawEndY = height - 1
 	}
 	if params.drawStartX < 0 {
 		params.drawStartX = 0
 	}
-	if params.drawEndX >= screenWidth {
-		params.drawEndX = screenWidth - 1
+	if params.drawEndX >= width {
+		params.drawEndX = width - 1
 	}
 	return SpriteVisiblePortion{
 		visibleStartY: visibleStartY,
@@ -448,20 +796,59 @@ func getVisiblePortionOfSprite(enemySprite *ebiten.Image, params SpriteParameter
 }
 
 // draw sprite column by column
-func (g *Game) drawSprite(screen *ebiten.Image, enemySprite *ebiten.Image, params SpriteParameters, visiblePortion SpriteVisiblePortion) {
+func (g *Game) drawSprite(screen *ebiten.Image, enemySprite *ebiten.Image, params SpriteParameters, visiblePortion SpriteVisiblePortion, light float64) {
+	width, _ := g.frameSize()
+	fog := g.fogColorM(params.transformY, light)
 	for stripe := visiblePortion.drawStartX; stripe < visiblePortion.drawEndX; stripe++ {
-		if params.transformY > 0 && stripe > 0 && stripe < screenWidth && params.transformY < g.zBuffer[stripe] {
-			op := &ebiten.DrawImageOptions{}
+		if params.transformY > 0 && stripe > 0 && stripe < width && params.transformY < g.caster.ZBuffer()[stripe] {
+			op := &colorm.DrawImageOptions{}
 			texX := int((float64(stripe-(-params.spriteWidth/2+params.spriteScreenX)) * float64(enemySprite.Bounds().Dx())) / float64(params.spriteWidth))
 			subImg := enemySprite.SubImage(image.Rect(texX, visiblePortion.visibleStartY, texX+1, visiblePortion.visibleEndY)).(*ebiten.Image)
 			scaleY := float64(visiblePortion.drawEndY-visiblePortion.drawStartY) / float64(visiblePortion.visibleEndY-visiblePortion.visibleStartY)
 			op.GeoM.Scale(1, scaleY)
 			op.GeoM.Translate(float64(stripe), float64(visiblePortion.drawStartY))
-			screen.DrawImage(subImg, op)
+			colorm.DrawImage(screen, subImg, fog, op)
 		}
 	}
 }
 
+// -- fog
+
+// how much of something dist tiles away is hidden by the fog, from 0 for none of it to 1 for all
+func (g *Game) fogAmount(dist float64) float64 {
+	return clamp((dist-g.fog.Start)/(g.fog.End-g.fog.Start), 0, 1)
+}
+
+// a flat colour faded into the fog
+func (g *Game) fogColor(c color.RGBA, dist float64) color.RGBA {
+	amount := g.fogAmount(dist)
+	mix := func(from, to uint8) uint8 {
+		return uint8(lerp(float64(from), float64(to), amount))
+	}
+	return color.RGBA{mix(c.R, g.fog.Color[0]), mix(c.G, g.fog.Color[1]), mix(c.B, g.fog.Color[2]), c.A}
+}
+
+// the fog to lay over something opaque dist tiles away
+func (g *Game) fogOverlay(dist float64) color.RGBA {
+	amount := g.fogAmount(dist)
+	return color.RGBA{
+		uint8(float64(g.fog.Color[0]) * amount),
+		uint8(float64(g.fog.Color[1]) * amount),
+		uint8(float64(g.fog.Color[2]) * amount),
+		uint8(255 * amount),
+	}
+}
+
+// shades a sprite dist tiles away in the given light and fades it into the fog. unlike
+// an overlay this keeps the sprite's transparent parts transparent
+func (g *Game) fogColorM(dist, light float64) colorm.ColorM {
+	amount := g.fogAmount(dist)
+	var fog colorm.ColorM
+	fog.Scale(light*(1-amount), light*(1-amount), light*(1-amount), 1)
+	fog.Translate(float64(g.fog.Color[0])/255*amount, float64(g.fog.Color[1])/255*amount, float64(g.fog.Color[2])/255*amount, 0)
+	return fog
+}
+
 func loadImageAsset(name string) *ebiten.Image {
 	readable, err := assets.Open(fmt.Sprintf("assets/%s", name))
 	if err != nil {
@@ -474,51 +861,133 @@ func loadImageAsset(name string) *ebiten.Image {
 	return img
 }
 
+// keycards lying flat on the floor, one per colour. drawn rather than loaded since they're
+// just coloured cards
+func newKeycardSprites() map[string]*ebiten.Image {
+	sprites := make(map[string]*ebiten.Image, len(sim.KeycardColors))
+	for name, cardColor := range sim.KeycardColors {
+		sprite := ebiten.NewImage(64, 64)
+		vector.DrawFilledRect(sprite, 22, 52, 20, 12, cardColor, false)
+		vector.DrawFilledRect(sprite, 22, 55, 20, 3, color.RGBA{240, 240, 240, 255}, false)
+		sprites[name] = sprite
+	}
+	return sprites
+}
+
+// a folded uniform with a cap on top, for the disguise pickup
+func newDisguiseSprite() *ebiten.Image {
+	sprite := ebiten.NewImage(64, 64)
+	vector.DrawFilledRect(sprite, 18, 50, 28, 14, color.RGBA{60, 70, 95, 255}, false)
+	vector.DrawFilledRect(sprite, 29, 50, 6, 5, color.RGBA{220, 220, 220, 255}, false)
+	vector.DrawFilledRect(sprite, 24, 44, 16, 6, color.RGBA{35, 40, 55, 255}, false)
+	return sprite
+}
+
 // -- game
 
+// Game draws the simulation and feeds it the player's input
 type Game struct {
-	player          Player
-	enemies         []Enemy
+	world           *sim.World
+	recording       *sim.Replay // the run so far, saved once it's over. nil if resumed from a save without one
+	playback        *Playback   // the replay being watched in GameState_Replay
 	minimap         *ebiten.Image
-	level           Level
-	gameOver        bool
+	levelFile       sim.LevelFile
+	campaign        *Campaign
+	levelIndex      int
+	state           GameState
 	enemySprites    map[string]*ebiten.Image
-	zBuffer         []float64
+	coinSprite      *ebiten.Image
+	keycardSprites  map[string]*ebiten.Image // by colour
+	disguiseSprite  *ebiten.Image
+	wallTextures    map[sim.LevelEntity]*ebiten.Image
+	floorTexture    *ebiten.Image
+	ceilingTexture  *ebiten.Image
+	frame           *ebiten.Image // the 3d view at the render resolution
+	caster          *raycast.Caster
+	fog             sim.Fog
+	lightImage      *ebiten.Image // the light map, one pixel per tile
+	lightPixels     []byte
+	drawables       []Drawable    // reused every frame
+	floorRows       triangleBatch // floor, ceiling, light and fog rows, reused every frame
+	ceilingRows     triangleBatch
+	lightRows       triangleBatch
+	fogRows         triangleBatch
 	prevMouseX      int
 	prevMouseY      int
 	discoveredAreas [][]float64
+	notice          string // shown over the game for a moment, like "Saved"
+	noticeUntil     time.Time
+	input           sim.Input   // input gathered since the last tick
+	lastUpdate      time.Time   // zero until the first update after entering play
+	accumulator     float64     // seconds of real time not simulated yet
+	previous        renderState // the world as of the tick before the last one
+	view            renderState // the world as drawn, between previous and the latest tick
+
+	levelSelectCursor   int
+	titleMenu           Menu
+	pauseMenu           Menu
+	settingsMenu        Menu
+	settings            Settings
+	settingsReturnState GameState
 }
 
+// NewGame loads the campaign and opens the title menu
 func NewGame() *Game {
-	file, err := assets.Open("assets/level-1.png")
+	campaign, err := LoadCampaign(assets)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	level := NewLevel(file)
+	g := newLevelGame(campaign, defaultSettings(), 0, time.Now().UnixNano())
+	g.setState(GameState_Title)
+	return g
+}
 
-	playerX, playerY := level.getPlayer()
-	player := NewPlayer(playerX, playerY)
+// a fresh run of one level of the campaign
+func newLevelGame(campaign *Campaign, settings Settings, levelIndex int, seed int64) *Game {
+	levelPath := campaign.levels[levelIndex]
+	levelFile, level := loadLevel(levelPath)
+
+	g := newWorldGame(campaign, settings, levelIndex, levelFile, sim.NewWorld(levelFile, level, seed))
+	g.recording = sim.NewReplay(levelPath, seed)
+	return g
+}
+
+// a game showing a world, new or restored, of one level of the campaign
+func newWorldGame(campaign *Campaign, settings Settings, levelIndex int, levelFile sim.LevelFile, world *sim.World) *Game {
+	level := world.Level
+	resolution := settings.renderResolution()
 
 	g := &Game{
-		player:          player,
-		minimap:         ebiten.NewImage(level.width()*minimapScale, level.height()*minimapScale),
-		level:           level,
-		enemies:         make([]Enemy, 0),
-		gameOver:        false,
+		world:           world,
+		previous:        snapshotWorld(world),
+		view:            snapshotWorld(world),
+		minimap:         ebiten.NewImage(level.Width()*minimapScale, level.Height()*minimapScale),
+		levelFile:       levelFile,
+		campaign:        campaign,
+		levelIndex:      levelIndex,
+		state:           GameState_Playing,
+		titleMenu:       newTitleMenu(),
+		pauseMenu:       newPauseMenu(),
+		settingsMenu:    newSettingsMenu(),
+		settings:        settings,
 		enemySprites:    loadEnemySprites(),
-		zBuffer:         make([]float64, screenWidth),
+		coinSprite:      loadImageAsset("coin.png"),
+		keycardSprites:  newKeycardSprites(),
+		disguiseSprite:  newDisguiseSprite(),
+		wallTextures:    loadWallTextures(),
+		floorTexture:    loadImageAsset("floor.png"),
+		ceilingTexture:  loadImageAsset("ceiling.png"),
+		frame:           ebiten.NewImage(resolution.width, resolution.height),
+		caster:          raycast.NewCaster(resolution.width, runtime.GOMAXPROCS(0)),
+		fog:             levelFile.FogSettings(),
+		lightImage:      ebiten.NewImage(level.Width(), level.Height()),
+		lightPixels:     make([]byte, level.Width()*level.Height()*4),
 		prevMouseX:      0,
 		prevMouseY:      0,
-		discoveredAreas: make([][]float64, level.height()),
-	}
-
-	for i := range g.discoveredAreas {
-		g.discoveredAreas[i] = make([]float64, level.width())
+		discoveredAreas: newDiscoveredAreas(level),
 	}
 
-	g.initializeEnemies()
-
 	g.generateStaticMinimap()
 
 	g.updateDiscoveredAreas()
@@ -526,219 +995,408 @@ func NewGame() *Game {
 	return g
 }
 
+// swap this game for another, stopping the ray casting workers it no longer needs
+func (g *Game) replace(next *Game) {
+	g.caster.Close()
+	g.frame.Deallocate()
+	g.lightImage.Deallocate()
+	*g = *next
+}
+
+// load and build a level from the assets. the level is changed as the world starts, so
+// every run needs its own
+func loadLevel(levelPath string) (sim.LevelFile, sim.Level) {
+	levelFile, level, err := buildLevel(levelPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return levelFile, level
+}
+
+// load and build a level from the assets, returning an error for a broken one rather than exiting
+func buildLevel(levelPath string) (sim.LevelFile, sim.Level, error) {
+	levelFile, err := sim.LoadLevelFile(assets, levelPath)
+	if err != nil {
+		return sim.LevelFile{}, nil, err
+	}
+
+	level, err := levelFile.BuildLevel(assets, levelPath)
+	if err != nil {
+		return sim.LevelFile{}, nil, fmt.Errorf("%s: %v", levelPath, err)
+	}
+
+	return levelFile, level, nil
+}
+
+// the screen is the size of the window. only the 3d view is drawn at the render resolution
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
+	return outsideWidth, outsideHeight
 }
 
 func (g *Game) Update() error {
-	if g.gameOver {
-		if ebiten.IsKeyPressed(ebiten.KeySpace) {
-			// reset the game
-			*g = *NewGame()
+	if ebiten.IsWindowBeingClosed() {
+		if g.isRunInProgress() {
+			g.suspendRun()
+		} else {
+			g.saveRecording()
 		}
-		return nil
+		return ebiten.Termination
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) {
+		toggleFullscreen()
+	}
+
+	switch g.state {
+	case GameState_Title:
+		return g.updateTitle()
+	case GameState_Playing:
+		g.updatePlaying()
+	case GameState_Paused:
+		g.updatePaused()
+	case GameState_LevelComplete:
+		g.updateLevelComplete()
+	case GameState_GameOver:
+		g.updateGameOver()
+	case GameState_Settings:
+		g.updateSettings()
+	case GameState_LevelSelect:
+		g.updateLevelSelect()
+	case GameState_Replay:
+		g.updateReplay()
 	}
+	return nil
+}
 
-	g.handleInput()
-	g.updateDiscoveredAreas()
-
-	// update enemies
-	for i := range g.enemies {
-		g.updateEnemy(&g.enemies[i])
+func (g *Game) updateGameOver() {
+	if ebiten.IsKeyPressed(ebiten.KeySpace) {
+		g.startLevel(g.levelIndex)
 	}
-
-	// check if player is in enemy's field of vision
-	if g.isPlayerDetectedByEnemy() {
-		g.gameOver = false // todo: set to true when not debugging
-		isPlayerDetected = true
-	} else {
-		isPlayerDetected = false
+	if inpututil.IsKeyJustPressed(ebiten.KeyL) {
+		g.openLevelSelect()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.setState(GameState_Title)
 	}
+}
 
-	return nil
+func (g *Game) updateLevelComplete() {
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		g.startLevel(g.levelIndex)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		if g.levelIndex+1 < len(g.campaign.levels) {
+			g.startLevel(g.levelIndex + 1)
+		} else {
+			g.openLevelSelect()
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyL) {
+		g.openLevelSelect()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.setState(GameState_Title)
+	}
 }
 
-func (g *Game) handleInput() {
-	if g.gameOver {
+func (g *Game) updatePlaying() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.pauseMenu.cursor = 0
+		g.setState(GameState_Paused)
+		return
+	}
+
+	if g.updateQuickSave() {
 		return
 	}
 
-	moveSpeed := g.player.speed
+	// run as many fixed ticks as real time has passed, carrying the remainder over
+	g.advanceClock(1)
+
+	g.readInput()
+	for g.accumulator >= sim.TickSeconds {
+		g.accumulator -= sim.TickSeconds
+		g.previous = snapshotWorld(g.world)
+		g.world.Step(g.input)
+		if g.recording != nil {
+			g.recording.Record(g.input, g.world)
+		}
 
-	strafeSpeed := g.player.speed * 0.75 // slightly slower strafing
+		// mouse movement and key presses are only applied once, keys stay held until they're released
+		g.input.Turn, g.input.Pitch, g.input.Interact = 0, 0, false
 
-	if ebiten.IsKeyPressed(ebiten.KeyW) {
-		g.movePlayer(moveSpeed, 0)
+		if g.world.Outcome != sim.Outcome_Playing {
+			break
+		}
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyS) {
-		g.movePlayer(-moveSpeed, 0)
+	g.updateDiscoveredAreas()
+	g.view = g.interpolate(g.accumulator / sim.TickSeconds)
+
+	switch g.world.Outcome {
+	case sim.Outcome_Escaped:
+		g.saveRecording()
+		g.setState(GameState_LevelComplete)
+		g.campaign.completeLevel(g.levelIndex, ticksToSeconds(g.world.ElapsedTicks))
+	case sim.Outcome_Caught:
+		g.saveRecording()
+		g.setState(GameState_GameOver)
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyA) {
-		g.strafePlayer(-strafeSpeed)
+}
+
+// update the input for the simulation's next tick from the keyboard and mouse. mouse
+// movement adds up until a tick uses it, in case a frame passes without one
+func (g *Game) readInput() {
+	turn, pitch := g.handleMouseLook()
+	g.input = sim.Input{
+		Forward:  ebiten.IsKeyPressed(ebiten.KeyW),
+		Backward: ebiten.IsKeyPressed(ebiten.KeyS),
+		Left:     ebiten.IsKeyPressed(ebiten.KeyA),
+		Right:    ebiten.IsKeyPressed(ebiten.KeyD),
+		Crouch:   ebiten.IsKeyPressed(ebiten.KeyControl),
+		Throw:    ebiten.IsKeyPressed(ebiten.KeyE),
+		Interact: g.input.Interact || inpututil.IsKeyJustPressed(ebiten.KeyF),
+		Turn:     g.input.Turn + turn,
+		Pitch:    g.input.Pitch + pitch,
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyD) {
-		g.strafePlayer(strafeSpeed)
+}
+
+// -- interpolation
+
+// longest stretch of real time simulated in one frame, so a stall doesn't have to be caught up on
+const maxFrameSeconds float64 = 0.25
+
+// the parts of the world that move smoothly between ticks when drawn
+type renderState struct {
+	player  sim.Player
+	enemies []sim.Enemy
+	coins   []sim.Coin
+}
+
+func snapshotWorld(w *sim.World) renderState {
+	return renderState{
+		player:  w.Player,
+		enemies: append([]sim.Enemy(nil), w.Enemies...),
+		coins:   append([]sim.Coin(nil), w.Coins...),
 	}
+}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyE) {
-		g.dropCoin()
+// blend from the previous tick towards the latest one, alpha being how far into the next tick real time is
+func (g *Game) interpolate(alpha float64) renderState {
+	current := snapshotWorld(g.world)
+
+	player := g.previous.player
+	player.X = lerp(player.X, current.player.X, alpha)
+	player.Y = lerp(player.Y, current.player.Y, alpha)
+	player.HeightOffset = lerp(player.HeightOffset, current.player.HeightOffset, alpha)
+	player.VerticalAngle = lerp(player.VerticalAngle, current.player.VerticalAngle, alpha)
+	player.IsCrouching = current.player.IsCrouching
+	turn := math.Atan2(current.player.DirY, current.player.DirX) - math.Atan2(player.DirY, player.DirX)
+	player.Rotate(math.Remainder(turn, 2*math.Pi) * alpha)
+	current.player = player
+
+	if len(g.previous.enemies) == len(current.enemies) {
+		for i := range current.enemies {
+			current.enemies[i].X = lerp(g.previous.enemies[i].X, current.enemies[i].X, alpha)
+			current.enemies[i].Y = lerp(g.previous.enemies[i].Y, current.enemies[i].Y, alpha)
+		}
 	}
 
-	if ebiten.IsKeyPressed(ebiten.KeyControl) {
-		g.player.speed = playerSpeedCrouching
-		g.adjustPlayerHeightOffset(playerCrouchingTransitionSpeed)
-	} else {
-		g.player.speed = playerSpeedStanding
-		g.adjustPlayerHeightOffset(-playerCrouchingTransitionSpeed)
+	// coins are only blended while none have been thrown or picked up since the last tick
+	if len(g.previous.coins) == len(current.coins) {
+		for i := range current.coins {
+			current.coins[i].X = lerp(g.previous.coins[i].X, current.coins[i].X, alpha)
+			current.coins[i].Y = lerp(g.previous.coins[i].Y, current.coins[i].Y, alpha)
+			current.coins[i].Z = lerp(g.previous.coins[i].Z, current.coins[i].Z, alpha)
+		}
 	}
 
-	g.handleMouseLook()
+	return current
+}
 
-	if ebiten.IsKeyPressed(ebiten.KeyEscape) {
-		os.Exit(0)
+// add the real time since the last update to the time waiting to be simulated, sped up or slowed down
+func (g *Game) advanceClock(speed float64) {
+	now := time.Now()
+	if !g.lastUpdate.IsZero() {
+		g.accumulator += math.Min(now.Sub(g.lastUpdate).Seconds(), maxFrameSeconds) * speed
 	}
+	g.lastUpdate = now
+}
+
+func lerp(from, to, t float64) float64 {
+	return from + (to-from)*t
 }
 
 func (g *Game) drawGameOver(screen *ebiten.Image) {
+	screenWidth, screenHeight := screen.Bounds().Dx(), screen.Bounds().Dy()
 	ebitenutil.DebugPrintAt(screen, "GAME OVER", screenWidth/2-40, screenHeight/2-10)
-	ebitenutil.DebugPrintAt(screen, "Press SPACE to restart", screenWidth/2-80, screenHeight/2+10)
+	ebitenutil.DebugPrintAt(screen, "Press SPACE to restart, L for level select or ESC for the title", screenWidth/2-190, screenHeight/2+10)
 }
 
-// -- ui
+func (g *Game) drawLevelComplete(screen *ebiten.Image) {
+	screenWidth, screenHeight := screen.Bounds().Dx(), screen.Bounds().Dy()
+	ebitenutil.DebugPrintAt(screen, "LEVEL COMPLETE", screenWidth/2-45, screenHeight/2-70)
+	ebitenutil.DebugPrintAt(screen, g.levelFile.DisplayName(), screenWidth/2-45, screenHeight/2-50)
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Time: %s (par %s)", formatTicks(g.world.ElapsedTicks), formatSeconds(g.levelFile.ParTime)), screenWidth/2-45, screenHeight/2-30)
+	if best, ok := g.campaign.bestTime(g.levelIndex); ok {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Best: %s", formatSeconds(best)), screenWidth/2-45, screenHeight/2-15)
+	}
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Coins used: %d", g.world.CoinsUsed), screenWidth/2-45, screenHeight/2)
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Times spotted: %d", g.world.TimesSpotted), screenWidth/2-45, screenHeight/2+20)
+	ebitenutil.DebugPrintAt(screen, "Press SPACE to restart, ENTER to continue, L for level select or ESC for the title", screenWidth/2-250, screenHeight/2+50)
+}
 
-var isPlayerDetected = false
+// format a number of update ticks as minutes, seconds and hundredths
+func formatTicks(ticks int) string {
+	return formatSeconds(ticksToSeconds(ticks))
+}
 
-func (g *Game) drawUI(screen *ebiten.Image) {
-	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("FPS: %0.2f", ebiten.ActualFPS()), 10, 10)
-	ebitenutil.DebugPrintAt(screen, "move with WASD, look with mouse, ctrl to crouch", 10, screenHeight-40)
-	ebitenutil.DebugPrintAt(screen, "ESC to exit", 10, screenHeight-20)
+func ticksToSeconds(ticks int) float64 {
+	return float64(ticks) / float64(sim.TickRate)
+}
 
-	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("height offset: %0.2f", g.player.heightOffset), 10, screenHeight-60)
+func formatSeconds(seconds float64) string {
+	centiseconds := int(seconds * 100)
+	return fmt.Sprintf("%d:%02d.%02d", centiseconds/6000, centiseconds/100%60, centiseconds%100)
+}
 
-	crouchStatus := "Standing"
-	if g.player.isCrouching {
-		crouchStatus = "Crouching"
-	}
-	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Status: %s", crouchStatus), 10, screenHeight-80)
+// -- level select
 
-	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Player Detected: %t", isPlayerDetected), 10, screenHeight-100)
+// replace the current run with a fresh run of a level
+func (g *Game) startLevel(index int) {
+	g.saveRecording()
+	g.replace(newLevelGame(g.campaign, g.settings, index, time.Now().UnixNano()))
+	g.setState(GameState_Playing)
 }
 
-// -- level
-
-type LevelEntity int
+func (g *Game) openLevelSelect() {
+	g.levelSelectCursor = g.levelIndex
+	g.setState(GameState_LevelSelect)
+}
 
-const (
-	LevelEntity_Empty LevelEntity = iota
-	LevelEntity_Wall
-	LevelEntity_Enemy
-	LevelEntity_Exit
-	LevelEntity_Player
-	LevelEntity_Construct
-)
+func (g *Game) updateLevelSelect() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.setState(GameState_Title)
+		return
+	}
 
-type LevelEntityColor = color.RGBA
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) || inpututil.IsKeyJustPressed(ebiten.KeyW) {
+		g.levelSelectCursor = (g.levelSelectCursor + len(g.campaign.levels) - 1) % len(g.campaign.levels)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) || inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		g.levelSelectCursor = (g.levelSelectCursor + 1) % len(g.campaign.levels)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) && g.campaign.isUnlocked(g.levelSelectCursor) {
+		g.startLevel(g.levelSelectCursor)
+	}
+}
 
-var (
-	LevelEntityColor_Empty     = color.RGBA{255, 255, 255, 255}
-	LevelEntityColor_Wall      = color.RGBA{0, 0, 0, 255}
-	LevelEntityColor_Enemy     = color.RGBA{255, 0, 0, 255}
-	LevelEntityColor_Exit      = color.RGBA{0, 255, 0, 255}
-	LevelEntityColor_Player    = color.RGBA{0, 0, 255, 255}
-	LevelEntityColor_Construct = color.RGBA{255, 255, 0, 255}
-)
+func (g *Game) drawLevelSelect(screen *ebiten.Image) {
+	screenWidth, screenHeight := screen.Bounds().Dx(), screen.Bounds().Dy()
+	x, y := screenWidth/2-150, screenHeight/2-40-10*len(g.campaign.levels)
+	ebitenutil.DebugPrintAt(screen, "SELECT LEVEL", x, y)
 
-type Level [][]LevelEntity
+	for i, levelFile := range g.campaign.levelFiles {
+		cursor := "  "
+		if i == g.levelSelectCursor {
+			cursor = "> "
+		}
 
-func NewLevel(file fs.File) Level {
-	defer file.Close()
+		status := "locked"
+		if g.campaign.isUnlocked(i) {
+			status = "best --:--.--"
+			if best, ok := g.campaign.bestTime(i); ok {
+				status = "best " + formatSeconds(best)
+			}
+			status += fmt.Sprintf("  par %s", formatSeconds(levelFile.ParTime))
+		}
 
-	img, _, err := image.Decode(file)
-	if err != nil {
-		log.Fatal(err)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s%d. %-20s %s", cursor, i+1, levelFile.DisplayName(), status), x, y+30+i*20)
 	}
 
-	bounds := img.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
+	ebitenutil.DebugPrintAt(screen, "UP/DOWN to choose, ENTER to play, ESC to go back", x, y+50+len(g.campaign.levels)*20)
+}
+
+// -- ui
+
+func (g *Game) drawUI(screen *ebiten.Image) {
+	screenWidth, screenHeight := screen.Bounds().Dx(), screen.Bounds().Dy()
+	ebitenutil.DebugPrintAt(screen, g.levelFile.DisplayName(), screenWidth/2-3*len(g.levelFile.DisplayName()), 10)
+	ebitenutil.DebugPrintAt(screen, "move with WASD, look with mouse, ctrl to crouch, hold E to throw a coin, F to use doors and switches", 10, screenHeight-40)
+	ebitenutil.DebugPrintAt(screen, "ESC to pause, F5 to quick-save, F9 to quick-load, F11 for fullscreen", 10, screenHeight-20)
+	g.drawInventory(screen)
+
+	if g.settings.showDebugInfo {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("FPS: %0.2f", ebiten.ActualFPS()), 10, 10)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("height offset: %0.2f", g.view.player.HeightOffset), 10, screenHeight-60)
+
+		crouchStatus := "Standing"
+		if g.view.player.IsCrouching {
+			crouchStatus = "Crouching"
+		}
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Status: %s", crouchStatus), 10, screenHeight-80)
 
-	matrix := make(Level, height)
-	for i := range matrix {
-		matrix[i] = make([]LevelEntity, width)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Player Detected: %t", g.world.PlayerDetected), 10, screenHeight-100)
 	}
 
-	// fill matrix based on pixel colors
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			c := img.At(x, y)
-
-			switch {
-			case c == LevelEntityColor_Empty:
-				matrix[y][x] = LevelEntity_Empty
-			case c == LevelEntityColor_Wall:
-				matrix[y][x] = LevelEntity_Wall
-			case c == LevelEntityColor_Enemy:
-				matrix[y][x] = LevelEntity_Enemy
-			case c == LevelEntityColor_Exit:
-				matrix[y][x] = LevelEntity_Exit
-			case c == LevelEntityColor_Player:
-				matrix[y][x] = LevelEntity_Player
-			case c == LevelEntityColor_Construct:
-				matrix[y][x] = LevelEntity_Construct
-			}
-		}
+	if time.Now().Before(g.noticeUntil) {
+		ebitenutil.DebugPrintAt(screen, g.notice, screenWidth/2-3*len(g.notice), 30)
 	}
 
-	return matrix
+	g.drawSuspicionMeters(screen)
 }
 
-func (level Level) getPlayer() (float64, float64) {
-	playerX := 0
-	playerY := 0
-	for y := 0; y < len(level); y++ {
-		for x := 0; x < len(level[y]); x++ {
-			if level[y][x] == LevelEntity_Player {
-				playerX = x
-				playerY = y
-				// remove player block from level so it doesn't render or collide
-				level[y][x] = LevelEntity_Empty
-				break
-			}
-		}
+// the held items, listed upwards from above the controls, and what a locked exit the player
+// is standing on needs
+func (g *Game) drawInventory(screen *ebiten.Image) {
+	screenWidth, screenHeight := screen.Bounds().Dx(), screen.Bounds().Dy()
+	inventory := g.world.Player.Inventory
+
+	lines := []string{fmt.Sprintf("Coins: %d", inventory.Coins)}
+	if len(inventory.Keycards) > 0 {
+		lines = append(lines, fmt.Sprintf("Keycards: %s", strings.Join(inventory.Keycards, ", ")))
+	}
+	if inventory.Disguised {
+		lines = append(lines, "Disguised")
+	}
+	for i, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, 10, screenHeight-120-20*i)
 	}
 
-	return float64(playerX), float64(playerY)
+	tileX, tileY := int(g.world.Player.X), int(g.world.Player.Y)
+	if keycard := g.world.ExitKeycard(tileX, tileY); !inventory.Unlocks(keycard) {
+		message := fmt.Sprintf("the exit needs the %s keycard", keycard)
+		ebitenutil.DebugPrintAt(screen, message, screenWidth/2-3*len(message), 50)
+	}
 }
 
-func (level Level) getEnemies() []Enemy {
-	enemies := []Enemy{}
-	for y := 0; y < len(level); y++ {
-		for x := 0; x < len(level[y]); x++ {
-			if level[y][x] == LevelEntity_Enemy {
-				enemies = append(enemies, Enemy{x: float64(x), y: float64(y)})
-				// remove enemy block from level so it doesn't render or collide
-				level[y][x] = LevelEntity_Empty
-			}
-		}
+// one bar per enemy, filling up and turning from yellow to red as its suspicion rises
+func (g *Game) drawSuspicionMeters(screen *ebiten.Image) {
+	const barWidth, barHeight, spacing = 100, 6, 14
+	x, y := 10, 30
+
+	ebitenutil.DebugPrintAt(screen, "Suspicion:", x, y)
+	for i, enemy := range g.view.enemies {
+		barY := float32(y + 20 + i*spacing)
+		vector.DrawFilledRect(screen, float32(x), barY, barWidth, barHeight, color.RGBA{40, 40, 40, 200}, false)
+
+		fillColor := color.RGBA{255, uint8(220 * (1 - enemy.Suspicion)), 0, 255}
+		vector.DrawFilledRect(screen, float32(x), barY, float32(barWidth*enemy.Suspicion), barHeight, fillColor, false)
+		ebitenutil.DebugPrintAt(screen, enemy.State.String(), x+barWidth+6, int(barY)-5)
 	}
-	return enemies
 }
 
-func (l Level) width() int                       { return len(l[0]) }
-func (l Level) height() int                      { return len(l) }
-func (l Level) getEntityAt(x, y int) LevelEntity { return l[y][x] }
-
 // -- minimap
 
 const minimapScale int = 8
 
 func (g *Game) generateStaticMinimap() {
-	g.minimap = ebiten.NewImage(g.level.width()*minimapScale, g.level.height()*minimapScale)
-	for y := 0; y < g.level.height(); y++ {
-		for x := 0; x < g.level.width(); x++ {
-			switch g.level.getEntityAt(x, y) {
-			case LevelEntity_Wall:
+	g.minimap = ebiten.NewImage(g.world.Level.Width()*minimapScale, g.world.Level.Height()*minimapScale)
+	for y := 0; y < g.world.Level.Height(); y++ {
+		for x := 0; x < g.world.Level.Width(); x++ {
+			switch g.world.Level.EntityAt(x, y) {
+			case sim.LevelEntity_Wall:
 				vector.DrawFilledRect(g.minimap, float32(x*minimapScale), float32(y*minimapScale), float32(minimapScale), float32(minimapScale), color.RGBA{50, 50, 50, 255}, false)
-			case LevelEntity_Construct:
+			case sim.LevelEntity_Construct:
 				vector.DrawFilledRect(g.minimap, float32(x*minimapScale), float32(y*minimapScale), float32(minimapScale), float32(minimapScale), color.RGBA{140, 140, 140, 255}, false)
 			default:
 				vector.DrawFilledRect(g.minimap, float32(x*minimapScale), float32(y*minimapScale), float32(minimapScale), float32(minimapScale), color.RGBA{140, 140, 140, 255}, false)
@@ -747,19 +1405,31 @@ func (g *Game) generateStaticMinimap() {
 	}
 }
 
+// the minimap sits in the top right corner of the screen
+func (g *Game) minimapX(screen *ebiten.Image) int {
+	return screen.Bounds().Dx() - g.world.Level.Width()*minimapScale - 10
+}
+
 func (g *Game) drawDynamicMinimap(screen *ebiten.Image) {
-	minimapImage := ebiten.NewImage(g.level.width()*minimapScale, g.level.height()*minimapScale)
+	minimapImage := ebiten.NewImage(g.world.Level.Width()*minimapScale, g.world.Level.Height()*minimapScale)
 
-	for y := 0; y < g.level.height(); y++ {
-		for x := 0; x < g.level.width(); x++ {
+	for y := 0; y < g.world.Level.Height(); y++ {
+		for x := 0; x < g.world.Level.Width(); x++ {
 			visibility := g.discoveredAreas[y][x]
 			if visibility > 0 {
 				var tileColor color.RGBA
-				switch g.level.getEntityAt(x, y) {
-				case LevelEntity_Wall:
+				switch g.world.Level.EntityAt(x, y) {
+				case sim.LevelEntity_Wall:
 					tileColor = color.RGBA{50, 50, 50, 255}
-				case LevelEntity_Construct:
+				case sim.LevelEntity_Construct:
 					tileColor = color.RGBA{140, 140, 140, 255}
+				case sim.LevelEntity_Glass:
+					tileColor = color.RGBA{120, 180, 210, 255}
+				case sim.LevelEntity_Door:
+					tileColor = color.RGBA{150, 100, 50, 255}
+					if door := g.world.DoorAt(x, y); door != nil && !door.Opening {
+						tileColor = color.RGBA{110, 70, 30, 255}
+					}
 				default:
 					tileColor = color.RGBA{200, 200, 200, 255}
 				}
@@ -777,21 +1447,47 @@ func (g *Game) drawDynamicMinimap(screen *ebiten.Image) {
 	}
 
 	op := &ebiten.DrawImageOptions{}
-	op.GeoM.Translate(float64(screenWidth-g.level.width()*minimapScale-10), 10)
+	op.GeoM.Translate(float64(g.minimapX(screen)), 10)
 	screen.DrawImage(minimapImage, op)
 
 	g.drawMinimapPlayer(screen)
 	g.drawMinimapEnemies(screen)
+	g.drawMinimapThrowPreview(screen)
+}
+
+// dotted arc showing where a coin thrown with the current charge would fly and land
+func (g *Game) drawMinimapThrowPreview(screen *ebiten.Image) {
+	if g.world.ThrowCharge == 0 || g.world.Player.Inventory.Coins == 0 {
+		return
+	}
+
+	offsetX := float32(g.minimapX(screen))
+	offsetY := float32(10)
+
+	for i, coin := range g.world.ThrowPreview() {
+		landed := coin.Landed
+		if i%2 == 0 || landed {
+			x := offsetX + float32(coin.X*float64(minimapScale))
+			y := offsetY + float32(coin.Y*float64(minimapScale))
+			vector.DrawFilledCircle(screen, x, y, 1, color.RGBA{255, 215, 0, 255}, false)
+		}
+		if landed {
+			x := offsetX + float32(coin.X*float64(minimapScale))
+			y := offsetY + float32(coin.Y*float64(minimapScale))
+			vector.StrokeCircle(screen, x, y, float32(minimapScale)/2, 1, color.RGBA{255, 215, 0, 255}, false)
+			return
+		}
+	}
 }
 
 func (g *Game) drawMinimapPlayer(screen *ebiten.Image) {
 	// calculate player position on minimap
-	playerX := float32(screenWidth - g.level.width()*minimapScale - 10 + int(g.player.x*float64(minimapScale)))
-	playerY := float32(10 + int(g.player.y*float64(minimapScale)))
+	playerX := float32(g.minimapX(screen) + int(g.view.player.X*float64(minimapScale)))
+	playerY := float32(10 + int(g.view.player.Y*float64(minimapScale)))
 
 	// calculate triangle points
 	triangleSize := float32(minimapScale)
-	angle := math.Atan2(g.player.dirY, g.player.dirX)
+	angle := math.Atan2(g.view.player.DirY, g.view.player.DirX)
 
 	x1 := playerX + triangleSize*float32(math.Cos(angle))
 	y1 := playerY + triangleSize*float32(math.Sin(angle))
@@ -814,7 +1510,7 @@ func (g *Game) drawMinimapPlayer(screen *ebiten.Image) {
 
 	// choose color based on crouching state
 	var playerColor color.RGBA
-	if g.player.isCrouching {
+	if g.view.player.IsCrouching {
 		playerColor = color.RGBA{0, 255, 0, 255} // green when crouching
 	} else {
 		playerColor = color.RGBA{0, 255, 255, 255} // teal when standing
@@ -829,20 +1525,20 @@ func (g *Game) drawMinimapPlayer(screen *ebiten.Image) {
 }
 
 func (g *Game) drawMinimapEnemies(screen *ebiten.Image) {
-	for _, enemy := range g.enemies {
-		enemyX, enemyY := int(enemy.x), int(enemy.y)
+	for _, enemy := range g.view.enemies {
+		enemyX, enemyY := int(enemy.X), int(enemy.Y)
 
 		if g.discoveredAreas[enemyY][enemyX] > 0 {
-			screenX := float32(screenWidth - g.level.width()*minimapScale - 10 + int(enemy.x*float64(minimapScale)))
-			screenY := float32(10 + int(enemy.y*float64(minimapScale)))
+			screenX := float32(g.minimapX(screen) + int(enemy.X*float64(minimapScale)))
+			screenY := float32(10 + int(enemy.Y*float64(minimapScale)))
 
 			// draw enemy (red)
 			vector.DrawFilledCircle(screen, screenX, screenY, float32(minimapScale)/2, color.RGBA{255, 0, 0, 255}, false)
 
 			// draw field of vision
-			centerAngle := math.Atan2(enemy.dirY, enemy.dirX)
-			leftAngle := centerAngle - enemy.fovAngle/2
-			rightAngle := centerAngle + enemy.fovAngle/2
+			centerAngle := math.Atan2(enemy.DirY, enemy.DirX)
+			leftAngle := centerAngle - enemy.FOVAngle/2
+			rightAngle := centerAngle + enemy.FOVAngle/2
 
 			// create vertices for the fov arc
 			const segments = 20
@@ -864,8 +1560,8 @@ func (g *Game) drawMinimapEnemies(screen *ebiten.Image) {
 			// arc vertices
 			for i := 0; i <= segments; i++ {
 				angle := leftAngle + (rightAngle-leftAngle)*float64(i)/float64(segments)
-				x := screenX + float32(math.Cos(angle)*enemy.fovDistance*float64(minimapScale))
-				y := screenY + float32(math.Sin(angle)*enemy.fovDistance*float64(minimapScale))
+				x := screenX + float32(math.Cos(angle)*enemy.FOVDistance*float64(minimapScale))
+				y := screenY + float32(math.Sin(angle)*enemy.FOVDistance*float64(minimapScale))
 				vertices[i+1] = ebiten.Vertex{
 					DstX:   x,
 					DstY:   y,
@@ -903,14 +1599,22 @@ func (g *Game) drawMinimapEnemies(screen *ebiten.Image) {
 
 var emptySubImage = ebiten.NewImage(3, 3).SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
 
+func newDiscoveredAreas(level sim.Level) [][]float64 {
+	discoveredAreas := make([][]float64, level.Height())
+	for i := range discoveredAreas {
+		discoveredAreas[i] = make([]float64, level.Width())
+	}
+	return discoveredAreas
+}
+
 func (g *Game) updateDiscoveredAreas() {
 	const discoveryRadius float64 = 5.0 // changes the discovery radius
 	const fadeRadius float64 = 2.0      // changes the fade effect radius
-	playerX, playerY := int(g.player.x), int(g.player.y)
+	playerX, playerY := int(g.world.Player.X), int(g.world.Player.Y)
 
 	for y := playerY - int(discoveryRadius) - int(fadeRadius); y <= playerY+int(discoveryRadius)+int(fadeRadius); y++ {
 		for x := playerX - int(discoveryRadius) - int(fadeRadius); x <= playerX+int(discoveryRadius)+int(fadeRadius); x++ {
-			if x >= 0 && x < g.level.width() && y >= 0 && y < g.level.height() {
+			if x >= 0 && x < g.world.Level.Width() && y >= 0 && y < g.world.Level.Height() {
 				dx, dy := float64(x-playerX), float64(y-playerY)
 				distance := math.Sqrt(dx*dx + dy*dy)
 
@@ -927,186 +1631,36 @@ func (g *Game) updateDiscoveredAreas() {
 
 // -- player
 
-const (
-	playerSpeedStanding            float64 = 0.05
-	playerSpeedCrouching           float64 = 0.01
-	playerStandingHeightOffset     float64 = 0.2
-	playerCrouchingHeightOffset    float64 = 0.6
-	playerCrouchingTransitionSpeed float64 = 0.03
-	mouseSensitivity               float64 = 0.002
-)
-
-type Player struct {
-	x, y           float64
-	dirX, dirY     float64
-	planeX, planeY float64
-	heightOffset   float64
-	isCrouching    bool
-	speed          float64
-	verticalAngle  float64
-}
-
-func NewPlayer(x, y float64) Player {
-	offset := 0.5 // offset to center player in tile
-
-	return Player{
-		x:             x + offset,
-		y:             y + offset,
-		dirX:          -1,
-		dirY:          0,
-		planeX:        0,
-		planeY:        0.66,
-		heightOffset:  playerStandingHeightOffset,
-		isCrouching:   false,
-		speed:         playerSpeedStanding,
-		verticalAngle: 0,
-	}
-}
-
-func (g *Game) movePlayer(forwardSpeed, strafeSpeed float64) {
-	nextX := g.player.x + g.player.dirX*forwardSpeed + g.player.planeX*strafeSpeed
-	nextY := g.player.y + g.player.dirY*forwardSpeed + g.player.planeY*strafeSpeed
-
-	if !g.playerCollision(nextX, g.player.y) {
-		g.player.x = nextX
-	}
-	if !g.playerCollision(g.player.x, nextY) {
-		g.player.y = nextY
-	}
-}
-
-func (g *Game) strafePlayer(speed float64) {
-	g.movePlayer(0, speed)
-}
+const mouseSensitivity float64 = 0.002
 
-func (g *Game) handleMouseLook() {
+// how far to turn and look up this tick, from how far the mouse moved since the last one
+func (g *Game) handleMouseLook() (float64, float64) {
 	cx, cy := ebiten.CursorPosition()
 
 	if g.prevMouseX == 0 && g.prevMouseY == 0 {
 		g.prevMouseX, g.prevMouseY = cx, cy
-		return
+		return 0, 0
 	}
 
-	sensitivityX := mouseSensitivity
-	sensitivityY := mouseSensitivity
+	sensitivityX := g.settings.mouseSensitivity
+	sensitivityY := g.settings.mouseSensitivity
+	if g.settings.invertMouseY {
+		sensitivityY = -sensitivityY
+	}
 
 	dx := float64(cx - g.prevMouseX)
 	dy := float64(cy - g.prevMouseY)
 
-	g.rotatePlayer(-dx * sensitivityX)
-
-	// handle vertical look
-	g.player.verticalAngle -= dy * sensitivityY
-
-	// clamp vertical angle to prevent looking too far up or down
-	maxVerticalAngle := math.Pi / 3 // 60 degrees
-	g.player.verticalAngle = math.Max(-maxVerticalAngle, math.Min(maxVerticalAngle, g.player.verticalAngle))
-
 	g.prevMouseX, g.prevMouseY = cx, cy
-}
-
-func (g *Game) rotatePlayer(angle float64) {
-	oldDirX := g.player.dirX
-	g.player.dirX = g.player.dirX*math.Cos(angle) - g.player.dirY*math.Sin(angle)
-	g.player.dirY = oldDirX*math.Sin(angle) + g.player.dirY*math.Cos(angle)
-	oldPlaneX := g.player.planeX
-	g.player.planeX = g.player.planeX*math.Cos(angle) - g.player.planeY*math.Sin(angle)
-	g.player.planeY = oldPlaneX*math.Sin(angle) + g.player.planeY*math.Cos(angle)
-}
-
-func (g *Game) adjustPlayerHeightOffset(delta float64) {
-	g.player.heightOffset += delta
-	// clamp the height
-	if g.player.heightOffset > playerCrouchingHeightOffset {
-		g.player.heightOffset = playerCrouchingHeightOffset
-	} else if g.player.heightOffset < playerStandingHeightOffset {
-		g.player.heightOffset = playerStandingHeightOffset
-	}
-	g.player.isCrouching = g.player.heightOffset == playerCrouchingHeightOffset
-}
-
-func (g *Game) playerCollision(x, y float64) bool {
-	// check position is within level bounds
-	if x < 0 || y < 0 || int(x) >= g.level.width() || int(y) >= g.level.height() {
-		return true
-	}
-
-	// check position is wall or construct
-	entity := g.level.getEntityAt(int(x), int(y))
-	if entity == LevelEntity_Wall || entity == LevelEntity_Construct {
-		return true
-	}
-
-	// check enemy collision
-	for _, enemy := range g.enemies {
-		dx := x - enemy.x
-		dy := y - enemy.y
-		distSquared := dx*dx + dy*dy
-		if distSquared < 0.25 { // collision radius of 0.5
-			g.gameOver = true // running into an enemy probably alerts them lol
-			return true
-		}
-	}
 
-	return false
+	return -dx * sensitivityX, -dy * sensitivityY
 }
 
 // -- enemy
 
-type Enemy struct {
-	x, y         float64
-	dirX, dirY   float64
-	patrolPoints []PatrolPoint
-	currentPoint int
-	speed        float64
-	fovAngle     float64
-	fovDistance  float64
-}
-
-func (g *Game) initializeEnemies() {
-	for _, enemyPos := range g.level.getEnemies() {
-		enemy := Enemy{
-			x:            enemyPos.x,
-			y:            enemyPos.y,
-			dirX:         1,
-			dirY:         0,
-			patrolPoints: generatePatrolPoints(g.level, enemyPos.x, enemyPos.y),
-			currentPoint: 0,
-			speed:        0.01,
-			fovAngle:     math.Pi / 3, // 60 degrees
-			fovDistance:  5,
-		}
-		g.enemies = append(g.enemies, enemy)
-	}
-}
-
-type PatrolPoint struct {
-	x, y float64
-}
-
-func generatePatrolPoints(level Level, startX, startY float64) []PatrolPoint {
-	// todo: do something more interesting here
-	points := []PatrolPoint{
-		{startX, startY},
-		{startX + 1, startY},
-		{startX + 2, startY + 2},
-		{startX, startY + 2},
-	}
-
-	// validate points (make sure they're not walls)
-	validPoints := make([]PatrolPoint, 0)
-	for _, p := range points {
-		if level.getEntityAt(int(p.x), int(p.y)) != LevelEntity_Wall {
-			validPoints = append(validPoints, p)
-		}
-	}
-
-	return validPoints
-}
-
 // normalize angle to [-π, π]
-func getNormalizedAngle(enemyToPlayerY float64, enemyToPlayerX float64, enemy *Enemy) float64 {
-	angle := math.Atan2(enemyToPlayerY, enemyToPlayerX) - math.Atan2(enemy.dirY, enemy.dirX)
+func getNormalizedAngle(enemyToPlayerY float64, enemyToPlayerX float64, enemy *sim.Enemy) float64 {
+	angle := math.Atan2(enemyToPlayerY, enemyToPlayerX) - math.Atan2(enemy.DirY, enemy.DirX)
 	for angle < -math.Pi {
 		angle += 2 * math.Pi
 	}
@@ -1134,114 +1688,3 @@ func loadEnemySprites() map[string]*ebiten.Image {
 
 	return enemySprites
 }
-
-func (g *Game) updateEnemy(e *Enemy) {
-	// move towards the current patrol point
-	targetX, targetY := e.patrolPoints[e.currentPoint].x, e.patrolPoints[e.currentPoint].y
-	dx, dy := targetX-e.x, targetY-e.y
-	dist := math.Sqrt(dx*dx + dy*dy)
-
-	if dist < e.speed {
-		// reached the current patrol point, move to the next one
-		e.currentPoint = (e.currentPoint + 1) % len(e.patrolPoints)
-	} else {
-		// move towards the current patrol point
-		e.x += (dx / dist) * e.speed
-		e.y += (dy / dist) * e.speed
-	}
-
-	// update direction
-	e.dirX, e.dirY = dx/dist, dy/dist
-}
-
-func (g *Game) isPlayerDetectedByEnemy() bool {
-	for _, enemy := range g.enemies {
-		if g.canEnemySeePlayer(&enemy) {
-			return true
-		}
-	}
-	return false
-}
-
-func (g *Game) canEnemySeePlayer(enemy *Enemy) bool {
-	// calculate angle and distance between enemy and player
-	dx := g.player.x - enemy.x
-	dy := g.player.y - enemy.y
-	distToPlayer := math.Sqrt(dx*dx + dy*dy)
-	angleToPlayer := math.Atan2(dy, dx)
-
-	// check if player is within enemy's fov and range
-	enemyAngle := math.Atan2(enemy.dirY, enemy.dirX)
-	angleDiff := math.Abs(angleToPlayer - enemyAngle)
-	if angleDiff > math.Pi {
-		angleDiff = 2*math.Pi - angleDiff
-	}
-
-	if distToPlayer <= enemy.fovDistance && angleDiff <= enemy.fovAngle/2 {
-		// check if there's a clear line of sight
-		steps := int(distToPlayer * 100) // change to adjust precision
-		lastConstructHeight := 0.0
-
-		for i := 0; i <= steps; i++ {
-			t := float64(i) / float64(steps)
-			checkX := enemy.x + t*dx
-			checkY := enemy.y + t*dy
-			checkTileX, checkTileY := int(checkX), int(checkY)
-
-			// check for out of bounds
-			if checkTileX < 0 || checkTileX >= g.level.width() || checkTileY < 0 || checkTileY >= g.level.height() {
-				return false
-			}
-
-			entity := g.level.getEntityAt(checkTileX, checkTileY)
-
-			// if we hit a wall, enemy can't see player
-			if entity == LevelEntity_Wall {
-				return false
-			}
-
-			// if we hit a construct
-			if entity == LevelEntity_Construct {
-				constructHeight := 0.5 // might change this if construct heights change
-				lastConstructHeight = constructHeight
-
-				// if this is the last step (player's position) and player is crouching
-				if i == steps && g.player.isCrouching {
-					return false // player is hidden behind the construct
-				}
-			}
-
-			// we've reached the player's position
-			if checkTileX == int(g.player.x) && checkTileY == int(g.player.y) {
-				if g.player.isCrouching && lastConstructHeight > 0 {
-					return false // player is crouching and there was a construct in the line of sight
-				}
-				return true // player can be seen
-			}
-		}
-	}
-	return false
-}
-
-// -- coin
-
-var (
-	coinSprite      = loadCoinSprite()
-	coins           []Coin
-	playerCoinCoint int = 3
-)
-
-type Coin struct {
-	x, y float64
-}
-
-func loadCoinSprite() *ebiten.Image {
-	return loadImageAsset("coin.png")
-}
-
-func (g *Game) dropCoin() {
-	if playerCoinCoint > 0 {
-		coins = append(coins, Coin{x: g.player.x, y: g.player.y})
-		playerCoinCoint--
-	}
-}
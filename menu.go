@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// -- game states
+
+type GameState int
+
+const (
+	GameState_Title GameState = iota
+	GameState_Playing
+	GameState_Paused
+	GameState_LevelComplete
+	GameState_GameOver
+	GameState_Settings
+	GameState_LevelSelect
+	GameState_Replay
+)
+
+// switch state, only capturing the cursor while actually playing
+func (g *Game) setState(state GameState) {
+	g.state = state
+	if state == GameState_Playing {
+		ebiten.SetCursorMode(ebiten.CursorModeCaptured)
+		// the cursor may have moved while it was free, so don't turn the player on the first tick back
+		g.prevMouseX, g.prevMouseY = 0, 0
+	} else {
+		ebiten.SetCursorMode(ebiten.CursorModeVisible)
+	}
+
+	// only offer to continue when there's a run to continue
+	if state == GameState_Title {
+		g.titleMenu.setEnabled(titleMenu_Continue, hasSave())
+	}
+
+	// don't catch up on the time spent away from the game
+	if state == GameState_Playing || state == GameState_Replay {
+		g.lastUpdate = time.Time{}
+		g.accumulator = 0
+	}
+}
+
+// -- menus
+
+// Menu is a vertical list of options picked with the arrow keys and enter
+type Menu struct {
+	items    []string
+	cursor   int
+	disabled map[int]bool // items shown but skipped over
+}
+
+// move the cursor and return the chosen item's index once enter is pressed
+func (m *Menu) update() (int, bool) {
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) || inpututil.IsKeyJustPressed(ebiten.KeyW) {
+		m.moveCursor(-1)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) || inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		m.moveCursor(1)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) && !m.disabled[m.cursor] {
+		return m.cursor, true
+	}
+	return 0, false
+}
+
+// step the cursor to the next enabled item in a direction, wrapping around
+func (m *Menu) moveCursor(step int) {
+	for range m.items {
+		m.cursor = (m.cursor + len(m.items) + step) % len(m.items)
+		if !m.disabled[m.cursor] {
+			return
+		}
+	}
+}
+
+func (m *Menu) setEnabled(item int, enabled bool) {
+	if m.disabled == nil {
+		m.disabled = make(map[int]bool)
+	}
+	m.disabled[item] = !enabled
+	if m.disabled[m.cursor] {
+		m.moveCursor(1)
+	}
+}
+
+func (m *Menu) draw(screen *ebiten.Image, title string) {
+	x, y := screen.Bounds().Dx()/2-80, screen.Bounds().Dy()/2-20-10*len(m.items)
+	ebitenutil.DebugPrintAt(screen, title, x, y)
+	for i, item := range m.items {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		if m.disabled[i] {
+			item = "(" + item + ")"
+		}
+		ebitenutil.DebugPrintAt(screen, cursor+item, x, y+30+i*20)
+	}
+}
+
+// -- title
+
+const (
+	titleMenu_Continue = iota
+	titleMenu_Play
+	titleMenu_LevelSelect
+	titleMenu_Settings
+	titleMenu_Quit
+)
+
+func newTitleMenu() Menu {
+	return Menu{items: []string{"Continue", "Play", "Select level", "Settings", "Quit"}}
+}
+
+func (g *Game) updateTitle() error {
+	choice, ok := g.titleMenu.update()
+	if !ok {
+		return nil
+	}
+
+	switch choice {
+	case titleMenu_Continue:
+		if err := g.loadGame(); err != nil {
+			log.Printf("failed to load save: %v", err)
+			g.titleMenu.setEnabled(titleMenu_Continue, false)
+		}
+	case titleMenu_Play:
+		// pick up from the furthest level reached
+		g.startLevel(g.campaign.progress.Unlocked - 1)
+	case titleMenu_LevelSelect:
+		g.openLevelSelect()
+	case titleMenu_Settings:
+		g.openSettings()
+	case titleMenu_Quit:
+		return ebiten.Termination
+	}
+	return nil
+}
+
+func (g *Game) drawTitle(screen *ebiten.Image) {
+	g.titleMenu.draw(screen, "OFFICE ESCAPE!")
+}
+
+// -- pause
+
+const (
+	pauseMenu_Resume = iota
+	pauseMenu_Restart
+	pauseMenu_Settings
+	pauseMenu_QuitToTitle
+)
+
+func newPauseMenu() Menu {
+	return Menu{items: []string{"Resume", "Restart level", "Settings", "Quit to title"}}
+}
+
+func (g *Game) updatePaused() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.setState(GameState_Playing)
+		return
+	}
+
+	choice, ok := g.pauseMenu.update()
+	if !ok {
+		return
+	}
+
+	switch choice {
+	case pauseMenu_Resume:
+		g.setState(GameState_Playing)
+	case pauseMenu_Restart:
+		g.startLevel(g.levelIndex)
+	case pauseMenu_Settings:
+		g.openSettings()
+	case pauseMenu_QuitToTitle:
+		g.suspendRun()
+		g.pauseMenu.cursor = 0
+		g.setState(GameState_Title)
+	}
+}
+
+// the frozen game with the pause menu on top
+func (g *Game) drawPaused(screen *ebiten.Image) {
+	g.drawPlaying(screen)
+	g.pauseMenu.draw(screen, "PAUSED")
+}
+
+// -- settings
+
+const (
+	mouseSensitivityStep float64 = 0.0005
+	mouseSensitivityMin  float64 = 0.0005
+	mouseSensitivityMax  float64 = 0.01
+)
+
+type Settings struct {
+	mouseSensitivity float64
+	invertMouseY     bool
+	showDebugInfo    bool
+	resolution       int // index into renderResolutions
+}
+
+func defaultSettings() Settings {
+	return Settings{
+		mouseSensitivity: mouseSensitivity,
+		invertMouseY:     false,
+		showDebugInfo:    true,
+		resolution:       renderResolution_Default,
+	}
+}
+
+// Resolution is the size the 3d view is drawn at before it's scaled up to the window
+type Resolution struct {
+	width, height int
+}
+
+// resolutions to choose from, lowest first
+var renderResolutions = []Resolution{
+	{320, 200}, // retro
+	{640, 400},
+	{800, 600},
+	{1024, 768},
+	{1600, 1200},
+}
+
+const renderResolution_Default = 3
+
+func (s Settings) renderResolution() Resolution {
+	return renderResolutions[s.resolution]
+}
+
+func (r Resolution) String() string {
+	return fmt.Sprintf("%dx%d", r.width, r.height)
+}
+
+const (
+	settingsMenu_Sensitivity = iota
+	settingsMenu_InvertMouseY
+	settingsMenu_DebugInfo
+	settingsMenu_Resolution
+	settingsMenu_Fullscreen
+	settingsMenu_Back
+)
+
+// settings can be opened from the title or pause menu and go back to wherever they came from
+func (g *Game) openSettings() {
+	g.settingsReturnState = g.state
+	g.settingsMenu.cursor = 0
+	g.setState(GameState_Settings)
+}
+
+func (g *Game) updateSettings() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.setState(g.settingsReturnState)
+		return
+	}
+
+	// left and right change the selected setting
+	change := 0
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) || inpututil.IsKeyJustPressed(ebiten.KeyA) {
+		change = -1
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyRight) || inpututil.IsKeyJustPressed(ebiten.KeyD) {
+		change = 1
+	}
+
+	choice, chosen := g.settingsMenu.update()
+	if chosen {
+		change = 1
+	} else {
+		choice = g.settingsMenu.cursor
+	}
+	if change == 0 {
+		return
+	}
+
+	switch choice {
+	case settingsMenu_Sensitivity:
+		sensitivity := g.settings.mouseSensitivity + float64(change)*mouseSensitivityStep
+		g.settings.mouseSensitivity = clamp(sensitivity, mouseSensitivityMin, mouseSensitivityMax)
+	case settingsMenu_InvertMouseY:
+		g.settings.invertMouseY = !g.settings.invertMouseY
+	case settingsMenu_DebugInfo:
+		g.settings.showDebugInfo = !g.settings.showDebugInfo
+	case settingsMenu_Resolution:
+		// wraps around, so enter steps through all of them
+		g.settings.resolution = (g.settings.resolution + change + len(renderResolutions)) % len(renderResolutions)
+	case settingsMenu_Fullscreen:
+		toggleFullscreen()
+	case settingsMenu_Back:
+		if chosen {
+			g.setState(g.settingsReturnState)
+		}
+	}
+}
+
+func (g *Game) drawSettings(screen *ebiten.Image) {
+	g.settingsMenu.items = []string{
+		fmt.Sprintf("Mouse sensitivity: < %.1f >", g.settings.mouseSensitivity*1000),
+		fmt.Sprintf("Invert mouse Y: %s", onOff(g.settings.invertMouseY)),
+		fmt.Sprintf("Show debug info: %s", onOff(g.settings.showDebugInfo)),
+		fmt.Sprintf("Render resolution: < %s >", g.settings.renderResolution()),
+		fmt.Sprintf("Fullscreen: %s", onOff(ebiten.IsFullscreen())),
+		"Back",
+	}
+	g.settingsMenu.draw(screen, "SETTINGS")
+}
+
+func newSettingsMenu() Menu {
+	return Menu{items: make([]string, settingsMenu_Back+1)}
+}
+
+// fullscreen isn't kept in the settings, the window can leave it by other means
+func toggleFullscreen() {
+	ebiten.SetFullscreen(!ebiten.IsFullscreen())
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func clamp(value, min, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
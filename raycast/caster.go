@@ -0,0 +1,240 @@
+// Package raycast finds what each screen column sees of a level, splitting the columns of a
+// frame between a pool of workers. it has no rendering code, so it can be timed without a display.
+package raycast
+
+import (
+	"math"
+	"sync"
+
+	"game/sim"
+)
+
+// -- ray casting
+
+// Hit is a tile a ray went into. rays carry on through every tile that can be seen
+// through, glass included, and stop at walls and door panels, so a column can see several
+type Hit struct {
+	Entity sim.LevelEntity
+	Dist   float64 // along the view direction, so walls don't bulge
+	Side   int     // 0 for a face crossed along x, 1 along y
+	WallX  float64 // where the ray hit the tile face, in [0, 1)
+
+	TileX, TileY int // the tile that was hit
+	FaceX, FaceY int // the tile in front of the face that was hit, which the ray came through
+}
+
+// Camera is where the rays start from and the spread of directions they're cast in
+type Camera struct {
+	X, Y           float64
+	DirX, DirY     float64
+	PlaneX, PlaneY float64 // half the width of the view, at right angles to the direction
+}
+
+// Caster casts one ray per column. its buffers are kept between frames, so casting a
+// frame doesn't allocate once every column has seen its most crowded view.
+type Caster struct {
+	width   int
+	workers int
+	chunks  int         // column ranges per frame, more than workers so a slow range doesn't hold up the rest
+	columns [][]Hit     // per column, nearest first
+	zBuffer []float64   // per column, distance to the wall that stopped the ray
+	world   *sim.World  // the frame being cast, read by the workers
+	camera  Camera      // the frame being cast, read by the workers
+	jobs    chan [2]int // column ranges, start inclusive and end exclusive
+	pending sync.WaitGroup
+}
+
+// NewCaster starts workers goroutines to cast frames width columns wide. with one
+// worker frames are cast on the calling goroutine instead
+func NewCaster(width, workers int) *Caster {
+	if workers < 1 {
+		workers = 1
+	}
+
+	c := &Caster{
+		width:   width,
+		workers: workers,
+		chunks:  workers * 4,
+		columns: make([][]Hit, width),
+		zBuffer: make([]float64, width),
+	}
+	if c.chunks > width {
+		c.chunks = width
+	}
+
+	if workers > 1 {
+		c.jobs = make(chan [2]int, c.chunks)
+		for i := 0; i < workers; i++ {
+			go c.work()
+		}
+	}
+	return c
+}
+
+// stop the workers. the caster can't be used afterwards
+func (c *Caster) Close() {
+	if c.jobs != nil {
+		close(c.jobs)
+		c.jobs = nil
+	}
+}
+
+func (c *Caster) Width() int {
+	return c.width
+}
+
+// what the ray through a column hit on the last frame, nearest first
+func (c *Caster) Column(x int) []Hit {
+	return c.columns[x]
+}
+
+// distance to the wall behind each column on the last frame, infinite where the ray left the level
+func (c *Caster) ZBuffer() []float64 {
+	return c.zBuffer
+}
+
+// cast every column of a frame, returning once they're all done. the world mustn't be
+// stepped until then
+func (c *Caster) Cast(world *sim.World, camera Camera) {
+	c.world, c.camera = world, camera
+
+	if c.jobs == nil {
+		c.castColumns(0, c.width)
+		return
+	}
+
+	c.pending.Add(c.chunks)
+	for i := 0; i < c.chunks; i++ {
+		c.jobs <- [2]int{i * c.width / c.chunks, (i + 1) * c.width / c.chunks}
+	}
+	c.pending.Wait()
+}
+
+func (c *Caster) work() {
+	for columns := range c.jobs {
+		c.castColumns(columns[0], columns[1])
+		c.pending.Done()
+	}
+}
+
+func (c *Caster) castColumns(start, end int) {
+	for x := start; x < end; x++ {
+		cameraX := 2*float64(x)/float64(c.width) - 1
+		rayDirX := c.camera.DirX + c.camera.PlaneX*cameraX
+		rayDirY := c.camera.DirY + c.camera.PlaneY*cameraX
+		c.columns[x], c.zBuffer[x] = c.castRay(c.columns[x][:0], rayDirX, rayDirY)
+	}
+}
+
+// step through the level a tile at a time (DDA) until the ray hits a wall, door panel or other
+// tile it can't see past, appending every tile it hits on the way. returns the hits and the
+// distance to the last one
+func (c *Caster) castRay(hits []Hit, rayDirX, rayDirY float64) ([]Hit, float64) {
+	camera := c.camera
+	level := c.world.Level
+	mapX, mapY := int(camera.X), int(camera.Y)
+	var sideDistX, sideDistY float64
+	deltaDistX := math.Abs(1 / rayDirX)
+	deltaDistY := math.Abs(1 / rayDirY)
+	var stepX, stepY int
+	var side int
+
+	if rayDirX < 0 {
+		stepX = -1
+		sideDistX = (camera.X - float64(mapX)) * deltaDistX
+	} else {
+		stepX = 1
+		sideDistX = (float64(mapX) + 1.0 - camera.X) * deltaDistX
+	}
+	if rayDirY < 0 {
+		stepY = -1
+		sideDistY = (camera.Y - float64(mapY)) * deltaDistY
+	} else {
+		stepY = 1
+		sideDistY = (float64(mapY) + 1.0 - camera.Y) * deltaDistY
+	}
+
+	zDist := math.Inf(1)
+	for {
+		faceX, faceY := mapX, mapY
+		if sideDistX < sideDistY {
+			sideDistX += deltaDistX
+			mapX += stepX
+			side = 0
+		} else {
+			sideDistY += deltaDistY
+			mapY += stepY
+			side = 1
+		}
+		// validated levels are closed off by walls, but never read outside the level
+		if !level.InBounds(mapX, mapY) {
+			return hits, zDist
+		}
+		hitEntity := level.EntityAt(mapX, mapY)
+		if hitEntity == sim.LevelEntity_Empty {
+			continue
+		}
+
+		// the panel is inset into the middle of the tile, rays carry on through the open part
+		if hitEntity == sim.LevelEntity_Door {
+			door := c.world.DoorAt(mapX, mapY)
+			if door == nil {
+				continue
+			}
+			hit, ok := c.hitDoor(door, rayDirX, rayDirY)
+			if !ok {
+				continue
+			}
+			hit.FaceX, hit.FaceY = faceX, faceY
+			return append(hits, hit), hit.Dist
+		}
+
+		var dist float64
+		if side == 0 {
+			dist = (float64(mapX) - camera.X + (1-float64(stepX))/2) / rayDirX
+		} else {
+			dist = (float64(mapY) - camera.Y + (1-float64(stepY))/2) / rayDirY
+		}
+
+		// exact coordinate along the tile face where the ray hit, used for texturing
+		var wallX float64
+		if side == 0 {
+			wallX = camera.Y + dist*rayDirY
+		} else {
+			wallX = camera.X + dist*rayDirX
+		}
+		wallX -= math.Floor(wallX)
+
+		// flip so textures aren't mirrored on opposite faces
+		if (side == 0 && rayDirX > 0) || (side == 1 && rayDirY < 0) {
+			wallX = 1 - wallX
+		}
+
+		zDist = dist
+		hits = append(hits, Hit{Entity: hitEntity, Dist: dist, Side: side, WallX: wallX, TileX: mapX, TileY: mapY, FaceX: faceX, FaceY: faceY})
+
+		if !level.TileAt(mapX, mapY).SeeThrough {
+			return hits, zDist
+		}
+	}
+}
+
+// where a ray meets a door's panel, which sits across the middle of its tile and slides
+// away from the tile's low edge as it opens. ok is false if the ray goes through the gap
+func (c *Caster) hitDoor(door *sim.Door, rayDirX, rayDirY float64) (Hit, bool) {
+	camera := c.camera
+	var dist, along float64
+	if door.Side == 0 {
+		dist = (float64(door.X) + 0.5 - camera.X) / rayDirX
+		along = camera.Y + dist*rayDirY - float64(door.Y)
+	} else {
+		dist = (float64(door.Y) + 0.5 - camera.Y) / rayDirY
+		along = camera.X + dist*rayDirX - float64(door.X)
+	}
+
+	// along is NaN when the ray runs alongside the panel, which misses it too
+	if dist <= 0 || !(along >= door.Open && along < 1) {
+		return Hit{}, false
+	}
+	return Hit{Entity: sim.LevelEntity_Door, Dist: dist, Side: door.Side, WallX: along - door.Open, TileX: door.X, TileY: door.Y}, true
+}
@@ -0,0 +1,84 @@
+package raycast
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"game/sim"
+)
+
+const (
+	benchLevelSize = 256
+	benchColumns   = 1024
+	benchTurnSteps = 600 // frames to turn all the way round in
+)
+
+// casting a large generated level at full resolution, on one goroutine and across the
+// worker pool
+func BenchmarkCast(b *testing.B) {
+	levelFile := benchLevelFile(benchLevelSize)
+	level, err := levelFile.BuildLevel(nil, "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	world := sim.NewWorld(levelFile, level, 0)
+
+	b.Run("serial", func(b *testing.B) {
+		benchCaster(b, world, 1)
+	})
+	b.Run("pooled", func(b *testing.B) {
+		benchCaster(b, world, runtime.GOMAXPROCS(0))
+	})
+}
+
+// cast frames from the player start in the middle of the level, turning round a little each frame
+func benchCaster(b *testing.B, world *sim.World, workers int) {
+	caster := NewCaster(benchColumns, workers)
+	defer caster.Close()
+
+	player := world.Player
+	turn := 2 * math.Pi / benchTurnSteps
+	cast := func() {
+		player.Rotate(turn)
+		caster.Cast(world, Camera{X: player.X, Y: player.Y, DirX: player.DirX, DirY: player.DirY, PlaneX: player.PlaneX, PlaneY: player.PlaneY})
+	}
+
+	// one turn first so the column buffers have grown to what the level needs
+	for i := 0; i < benchTurnSteps; i++ {
+		cast()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cast()
+	}
+}
+
+// an open plan floor with the player in the middle, rows of desks and the odd pillar, so
+// rays go a long way and pass through several constructs before hitting a wall
+func benchLevelFile(size int) sim.LevelFile {
+	tiles := make([]string, size)
+	row := make([]byte, size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			switch {
+			case x == 0 || y == 0 || x == size-1 || y == size-1:
+				row[x] = '#'
+			case x == size/2 && y == size/2:
+				row[x] = 'P'
+			case x == size-2 && y == size-2:
+				row[x] = 'X'
+			case x%17 == 8 && y%17 == 8:
+				row[x] = '#'
+			case y%6 == 3 && x%8 < 3:
+				row[x] = 'C'
+			default:
+				row[x] = '.'
+			}
+		}
+		tiles[y] = string(row)
+	}
+	return sim.LevelFile{Name: "Bench", Tiles: tiles}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"game/sim"
+)
+
+// -- replays
+
+const (
+	replaysDirName    = "replays"
+	replayFileExt     = ".replay"
+	replaySeekSeconds = 5
+	replaySpeedMin    = 0.25
+	replaySpeedMax    = 8.0
+)
+
+// Playback is a replay being watched, re-simulated from its seed and inputs
+type Playback struct {
+	replay     *sim.Replay
+	paused     bool
+	speed      float64 // multiple of real time
+	divergedAt int     // first tick that didn't match the recording, 0 while they all have
+}
+
+// the replay subcommand watches a replay, or with -verify plays replays back without drawing
+// them and reports any that don't match their recording. returns the process exit code.
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	verify := flags.Bool("verify", false, "check replays play back the same way instead of watching one")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || (!*verify && flags.NArg() > 1) {
+		fmt.Fprintln(os.Stderr, "usage: office-escape replay <file.replay>\n       office-escape replay -verify <file.replay>...")
+		return 2
+	}
+
+	if *verify {
+		campaign, err := LoadCampaign(assets)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		exitCode := 0
+		for _, p := range flags.Args() {
+			if err := verifyReplayFile(campaign, p); err != nil {
+				fmt.Printf("%s: %s\n", p, err)
+				exitCode = 1
+				continue
+			}
+			fmt.Printf("%s: ok\n", p)
+		}
+		return exitCode
+	}
+
+	replay, err := readReplayFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+	g := NewGame()
+	if err := g.startReplay(replay); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+	runGame(g)
+	return 0
+}
+
+// play a replay back against the campaign's copy of its level. a replay of a level that's
+// missing or broken fails on its own, leaving the others to be checked
+func verifyReplayFile(campaign *Campaign, p string) error {
+	replay, err := readReplayFile(p)
+	if err != nil {
+		return err
+	}
+	if campaign.levelIndex(replay.Level) < 0 {
+		return fmt.Errorf("replay is of level %q, which isn't in the campaign", replay.Level)
+	}
+	levelFile, level, err := buildLevel(replay.Level)
+	if err != nil {
+		return err
+	}
+	if tick := replay.Verify(sim.NewWorld(levelFile, level, replay.Seed)); tick >= 0 {
+		return fmt.Errorf("diverged from the recording at %s", formatTicks(tick))
+	}
+	return nil
+}
+
+func readReplayFile(p string) (*sim.Replay, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return sim.ReadReplay(file)
+}
+
+func writeReplayFile(p string, replay *sim.Replay) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if err := replay.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// save the finished or abandoned run to the replays in the config directory. runs
+// that never got going aren't worth keeping
+func (g *Game) saveRecording() {
+	recording := g.recording
+	g.recording = nil
+	if recording == nil || len(recording.Inputs) == 0 {
+		return
+	}
+
+	dir, err := configDir()
+	if err != nil {
+		log.Printf("failed to save replay: %v", err)
+		return
+	}
+
+	levelName := strings.TrimSuffix(path.Base(recording.Level), path.Ext(recording.Level))
+	name := fmt.Sprintf("%s-%s%s", time.Now().Format("20060102-150405"), levelName, replayFileExt)
+	if err := writeReplayFile(filepath.Join(dir, replaysDirName, name), recording); err != nil {
+		log.Printf("failed to save replay: %v", err)
+	}
+}
+
+// replace the current run with a replay of one, from the start
+func (g *Game) startReplay(replay *sim.Replay) error {
+	levelIndex := g.campaign.levelIndex(replay.Level)
+	if levelIndex < 0 {
+		return fmt.Errorf("replay is of level %q, which isn't in the campaign", replay.Level)
+	}
+
+	g.replace(newLevelGame(g.campaign, g.settings, levelIndex, replay.Seed))
+	g.recording = nil
+	g.playback = &Playback{replay: replay, speed: 1}
+	g.setState(GameState_Replay)
+	return nil
+}
+
+func (g *Game) updateReplay() {
+	p := g.playback
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.setState(GameState_Title)
+		return
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		p.paused = !p.paused
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		p.speed = clamp(p.speed*2, replaySpeedMin, replaySpeedMax)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		p.speed = clamp(p.speed/2, replaySpeedMin, replaySpeedMax)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		g.seekReplay(g.world.ElapsedTicks - replaySeekSeconds*sim.TickRate)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+		g.seekReplay(g.world.ElapsedTicks + replaySeekSeconds*sim.TickRate)
+	}
+
+	speed := p.speed
+	if p.paused {
+		speed = 0
+	}
+	g.advanceClock(speed)
+
+	for g.accumulator >= sim.TickSeconds && !g.replayFinished() {
+		g.accumulator -= sim.TickSeconds
+		g.previous = snapshotWorld(g.world)
+		g.stepReplay()
+	}
+	if g.replayFinished() {
+		g.accumulator = 0
+	}
+
+	g.updateDiscoveredAreas()
+	g.view = g.interpolate(g.accumulator / sim.TickSeconds)
+}
+
+func (g *Game) replayFinished() bool {
+	return g.world.ElapsedTicks >= len(g.playback.replay.Inputs) || g.world.Outcome != sim.Outcome_Playing
+}
+
+// run the next recorded tick, noting the first time the world stops matching the recording
+func (g *Game) stepReplay() {
+	p := g.playback
+	g.world.Step(p.replay.Inputs[g.world.ElapsedTicks])
+	if p.divergedAt == 0 && !p.replay.Matches(g.world) {
+		p.divergedAt = g.world.ElapsedTicks
+	}
+}
+
+// jump to a tick. going back means starting over from the seed, the simulation can't run backwards
+func (g *Game) seekReplay(tick int) {
+	p := g.playback
+	if tick < g.world.ElapsedTicks {
+		levelFile, level := loadLevel(p.replay.Level)
+		g.world = sim.NewWorld(levelFile, level, p.replay.Seed)
+		g.discoveredAreas = newDiscoveredAreas(level)
+	}
+
+	for g.world.ElapsedTicks < tick && !g.replayFinished() {
+		g.stepReplay()
+		g.updateDiscoveredAreas()
+	}
+
+	g.previous = snapshotWorld(g.world)
+	g.view = g.previous
+	g.accumulator = 0
+}
+
+// the run as usual, with a progress bar and the playback controls along the top
+func (g *Game) drawReplay(screen *ebiten.Image) {
+	const barWidth, barHeight = 400, 6
+	g.drawPlaying(screen)
+
+	p := g.playback
+	x, y := screen.Bounds().Dx()/2-barWidth/2, 40
+	total := len(p.replay.Inputs)
+
+	vector.DrawFilledRect(screen, float32(x), float32(y), barWidth, barHeight, color.RGBA{40, 40, 40, 200}, false)
+	if total > 0 {
+		progress := float32(g.world.ElapsedTicks) / float32(total)
+		vector.DrawFilledRect(screen, float32(x), float32(y), barWidth*progress, barHeight, color.RGBA{255, 255, 255, 255}, false)
+	}
+	if p.divergedAt > 0 && total > 0 {
+		divergedX := float32(x) + barWidth*float32(p.divergedAt)/float32(total)
+		vector.DrawFilledRect(screen, divergedX-1, float32(y-3), 2, barHeight+6, color.RGBA{255, 0, 0, 255}, false)
+	}
+
+	status := fmt.Sprintf("REPLAY  %s / %s  x%g", formatTicks(g.world.ElapsedTicks), formatTicks(total), p.speed)
+	if g.replayFinished() {
+		status += "  (finished)"
+	} else if p.paused {
+		status += "  (paused)"
+	}
+	ebitenutil.DebugPrintAt(screen, status, x, y+10)
+	ebitenutil.DebugPrintAt(screen, "SPACE play/pause, LEFT/RIGHT seek, UP/DOWN speed, ESC quit", x, y+25)
+
+	if p.divergedAt > 0 {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("DIVERGED from the recording at %s", formatTicks(p.divergedAt)), x, y+45)
+	}
+}
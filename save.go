@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"game/sim"
+)
+
+// -- saves
+
+const (
+	saveVersion    = 1
+	saveFileName   = "save.json"
+	noticeDuration = 2 * time.Second
+)
+
+// SaveFile is a run in the middle of a level, written by quick-saving or quitting to the title
+type SaveFile struct {
+	Version         int           `json:"version"`
+	Level           string        `json:"level"` // level file path within the assets
+	World           sim.WorldSave `json:"world"`
+	DiscoveredAreas [][]float64   `json:"discoveredAreas"`
+	Replay          []byte        `json:"replay,omitempty"` // the recording so far, so it carries on after loading
+}
+
+func savePath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, saveFileName), nil
+}
+
+func hasSave() bool {
+	p, err := savePath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+// quick-save and quick-load while playing. returns true when the run was replaced by the save
+func (g *Game) updateQuickSave() bool {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+		if err := g.saveGame(); err != nil {
+			g.showNotice(fmt.Sprintf("Save failed: %v", err))
+		} else {
+			g.showNotice("Saved")
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		if err := g.loadGame(); err != nil {
+			g.showNotice(fmt.Sprintf("Load failed: %v", err))
+			return false
+		}
+		g.showNotice("Loaded")
+		return true
+	}
+	return false
+}
+
+func (g *Game) saveGame() error {
+	if g.world.Outcome != sim.Outcome_Playing {
+		return errors.New("the run is over")
+	}
+
+	save := SaveFile{
+		Version:         saveVersion,
+		Level:           g.campaign.levels[g.levelIndex],
+		World:           g.world.Save(),
+		DiscoveredAreas: g.discoveredAreas,
+	}
+	if g.recording != nil {
+		var buf bytes.Buffer
+		if err := g.recording.Write(&buf); err != nil {
+			return err
+		}
+		save.Replay = buf.Bytes()
+	}
+
+	data, err := json.Marshal(save)
+	if err != nil {
+		return err
+	}
+	p, err := savePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o644)
+}
+
+// whether the game is in the middle of a run worth keeping, rather than idling behind the
+// title or playing back a replay
+func (g *Game) isRunInProgress() bool {
+	switch g.state {
+	case GameState_Playing, GameState_Paused:
+		return true
+	case GameState_Settings:
+		return g.settingsReturnState == GameState_Paused
+	default:
+		return false
+	}
+}
+
+// keep the run to continue from the title, and its recording so far
+func (g *Game) suspendRun() {
+	if err := g.saveGame(); err != nil {
+		log.Printf("failed to save game: %v", err)
+	}
+	g.saveRecording()
+}
+
+// replace the current run with the saved one and carry on playing it
+func (g *Game) loadGame() error {
+	p, err := savePath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+
+	var save SaveFile
+	if err := json.Unmarshal(data, &save); err != nil {
+		return err
+	}
+	if save.Version != saveVersion {
+		return fmt.Errorf("save version %d is not supported, expected %d", save.Version, saveVersion)
+	}
+
+	levelIndex := g.campaign.levelIndex(save.Level)
+	if levelIndex < 0 {
+		return fmt.Errorf("save is of level %q, which isn't in the campaign", save.Level)
+	}
+
+	levelFile, level, err := buildLevel(save.Level)
+	if err != nil {
+		return err
+	}
+	world, err := sim.RestoreWorld(levelFile, level, save.World)
+	if err != nil {
+		return err
+	}
+
+	var recording *sim.Replay
+	if len(save.Replay) > 0 {
+		if recording, err = sim.ReadReplay(bytes.NewReader(save.Replay)); err != nil {
+			return err
+		}
+	}
+
+	// the old run is abandoned, so it's done recording
+	g.saveRecording()
+	g.replace(newWorldGame(g.campaign, g.settings, levelIndex, levelFile, world))
+	// a save without its recording carries on unrecorded, there's no start to play back from
+	g.recording = recording
+	if isLevelSized(save.DiscoveredAreas, level) {
+		g.discoveredAreas = save.DiscoveredAreas
+	}
+	g.setState(GameState_Playing)
+	return nil
+}
+
+// whether the saved minimap has a value for every tile of the level
+func isLevelSized(areas [][]float64, level sim.Level) bool {
+	if len(areas) != level.Height() {
+		return false
+	}
+	for _, row := range areas {
+		if len(row) != level.Width() {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Game) showNotice(notice string) {
+	g.notice = notice
+	g.noticeUntil = time.Now().Add(noticeDuration)
+}
@@ -0,0 +1,155 @@
+package sim
+
+import "math"
+
+// -- coin
+
+const (
+	coinNoiseRadius  float64 = 6
+	coinPickupRadius float64 = 0.5
+)
+
+const (
+	coinThrowChargeSpeed float64 = 1.2 // charge gained per second while holding the throw key
+	coinThrowSpeedMin    float64 = 3.6 // tiles per second
+	coinThrowSpeedMax    float64 = 15
+	coinThrowLift        float64 = 3    // upward speed on release, in tiles per second
+	coinGravity          float64 = 14.4 // tiles per second per second
+	coinBounceDamping    float64 = 0.5
+	coinPreviewSteps     int     = 240 // ticks
+)
+
+type Coin struct {
+	X, Y       float64
+	Z          float64 // height above the floor
+	vx, vy, vz float64 // tiles per second
+	Landed     bool
+}
+
+func (w *World) throwCoin() {
+	if w.Player.Inventory.Coins > 0 {
+		w.Coins = append(w.Coins, w.newThrownCoin())
+		w.Player.Inventory.Coins--
+		w.CoinsUsed++
+	}
+}
+
+// a coin leaving the player's hand in the facing direction, with the current charge
+func (w *World) newThrownCoin() Coin {
+	speed := coinThrowSpeedMin + (coinThrowSpeedMax-coinThrowSpeedMin)*w.ThrowCharge
+	dirLength := math.Sqrt(w.Player.DirX*w.Player.DirX + w.Player.DirY*w.Player.DirY)
+
+	// looking up throws higher, looking down throws lower
+	lift := math.Max(0, coinThrowLift+speed*math.Tan(w.Player.VerticalAngle))
+
+	return Coin{
+		X:  w.Player.X,
+		Y:  w.Player.Y,
+		Z:  1 - w.Player.HeightOffset,
+		vx: w.Player.DirX / dirLength * speed,
+		vy: w.Player.DirY / dirLength * speed,
+		vz: lift,
+	}
+}
+
+// where a coin thrown now with the current charge would fly, one position per tick until it
+// lands or the preview runs out. the last coin is Landed if it came down in time
+func (w *World) ThrowPreview() []Coin {
+	coin := w.newThrownCoin()
+	path := make([]Coin, 0, coinPreviewSteps)
+	for i := 0; i < coinPreviewSteps; i++ {
+		landed := w.stepCoin(&coin)
+		path = append(path, coin)
+		if landed {
+			break
+		}
+	}
+	return path
+}
+
+// move coins still in the air, making a noise where each one lands
+func (w *World) updateCoins() {
+	for i := range w.Coins {
+		coin := &w.Coins[i]
+		if coin.Landed {
+			continue
+		}
+		if w.stepCoin(coin) {
+			w.makeNoise(coin.X, coin.Y, coinNoiseRadius)
+		}
+	}
+	w.pickUpCoinsNearPlayer()
+}
+
+// advance a flying coin by one tick, bouncing off walls, glass and closed doors and stopping
+// dead against constructs and other cover. returns true on the tick the coin lands
+func (w *World) stepCoin(c *Coin) bool {
+	if c.Landed {
+		return false
+	}
+
+	if nextX := c.X + c.vx*TickSeconds; w.isCoinBlocked(nextX, c.Y) {
+		if w.Level.isCoinStopped(nextX, c.Y) {
+			c.vx, c.vy = 0, 0
+		} else {
+			c.vx = -c.vx * coinBounceDamping
+		}
+	} else {
+		c.X = nextX
+	}
+
+	if nextY := c.Y + c.vy*TickSeconds; w.isCoinBlocked(c.X, nextY) {
+		if w.Level.isCoinStopped(c.X, nextY) {
+			c.vx, c.vy = 0, 0
+		} else {
+			c.vy = -c.vy * coinBounceDamping
+		}
+	} else {
+		c.Y = nextY
+	}
+
+	c.vz -= coinGravity * TickSeconds
+	c.Z += c.vz * TickSeconds
+	if c.Z <= 0 {
+		c.Z = 0
+		c.vx, c.vy, c.vz = 0, 0, 0
+		c.Landed = true
+	}
+	return c.Landed
+}
+
+func (w *World) isCoinBlocked(x, y float64) bool {
+	tileX, tileY := int(math.Floor(x)), int(math.Floor(y))
+	return !w.Level.isWalkable(tileX, tileY) || w.isBlockedByDoor(tileX, tileY)
+}
+
+func (l Level) isCoinStopped(x, y float64) bool {
+	tileX, tileY := int(math.Floor(x)), int(math.Floor(y))
+	return l.InBounds(tileX, tileY) && l.TileAt(tileX, tileY).isCover()
+}
+
+// enemies pocket any coin they walk over, so each coin only works as a distraction once
+func (w *World) pickUpCoinsNear(e *Enemy) {
+	w.Coins = removeCoinsNear(w.Coins, e.X, e.Y, func(Coin) {})
+}
+
+// the player gets back any coin lying on the floor that they walk over
+func (w *World) pickUpCoinsNearPlayer() {
+	w.Coins = removeCoinsNear(w.Coins, w.Player.X, w.Player.Y, func(Coin) {
+		w.Player.Inventory.Coins++
+	})
+}
+
+// remove the landed coins within reach of a point, calling pickUp for each one
+func removeCoinsNear(coins []Coin, x, y float64, pickUp func(Coin)) []Coin {
+	remaining := coins[:0]
+	for _, coin := range coins {
+		dx, dy := coin.X-x, coin.Y-y
+		if coin.Landed && dx*dx+dy*dy <= coinPickupRadius*coinPickupRadius {
+			pickUp(coin)
+			continue
+		}
+		remaining = append(remaining, coin)
+	}
+	return remaining
+}
@@ -0,0 +1,204 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// a room with a guard near the west end and another one too far east to hear anything
+// from there, the player in between
+func newCoinNoiseTestWorld(t *testing.T) *World {
+	t.Helper()
+	f := LevelFile{
+		Tiles: []string{
+			"############",
+			"#..........#",
+			"#.....P....#",
+			"############",
+		},
+		Enemies: []EnemySpawn{
+			{X: 2, Y: 1, Patrol: [][2]int{{2, 1}}},
+			{X: 10, Y: 1, Patrol: [][2]int{{10, 1}}},
+		},
+	}
+	return NewWorld(f, levelFromTestTiles(t, f), 1)
+}
+
+func TestLandingCoinsDrawEnemies(t *testing.T) {
+	w := newCoinNoiseTestWorld(t)
+	w.Coins = []Coin{{X: 3.5, Y: 1.5, Z: 0.01, vz: -1}}
+
+	w.updateCoins()
+	if !w.Coins[0].Landed {
+		t.Fatal("the coin didn't land")
+	}
+	w.propagateNoises()
+
+	near, far := &w.Enemies[0], &w.Enemies[1]
+	if near.State != EnemyState_Investigate {
+		t.Errorf("the enemy a tile from the coin is in state %d, expected it investigating", near.State)
+	}
+	if near.target != (PatrolPoint{3.5, 1.5}) {
+		t.Errorf("the enemy is investigating %v, expected where the coin landed", near.target)
+	}
+	if far.State != EnemyState_Patrol {
+		t.Errorf("the enemy seven tiles from the coin is in state %d, expected it still patrolling", far.State)
+	}
+}
+
+func TestCoinsInTheAirMakeNoNoise(t *testing.T) {
+	w := newCoinNoiseTestWorld(t)
+	w.Coins = []Coin{{X: 3.5, Y: 1.5, Z: 1}}
+
+	w.updateCoins()
+	w.propagateNoises()
+	if state := w.Enemies[0].State; state != EnemyState_Patrol {
+		t.Errorf("the enemy is in state %d while the coin is still falling, expected it patrolling", state)
+	}
+}
+
+func TestEnemiesPocketCoins(t *testing.T) {
+	w := newCoinNoiseTestWorld(t)
+	enemy := &w.Enemies[0]
+	w.Coins = []Coin{{X: enemy.X + 0.3, Y: enemy.Y, Landed: true}, {X: enemy.X + 2, Y: enemy.Y, Landed: true}}
+	coins := w.Player.Inventory.Coins
+
+	w.pickUpCoinsNear(enemy)
+	if len(w.Coins) != 1 || w.Coins[0].X != enemy.X+2 {
+		t.Errorf("coins left after the enemy picked up the one at its feet: %+v", w.Coins)
+	}
+	if w.Player.Inventory.Coins != coins {
+		t.Errorf("the player has %d coins after an enemy picked one up, expected %d", w.Player.Inventory.Coins, coins)
+	}
+}
+
+func TestPlayerPicksUpLandedCoins(t *testing.T) {
+	w := newCoinNoiseTestWorld(t)
+	x, y := w.Player.X, w.Player.Y
+	w.Coins = []Coin{{X: x, Y: y, Z: 1}, {X: x + 0.2, Y: y, Landed: true}}
+
+	w.pickUpCoinsNearPlayer()
+	if w.Player.Inventory.Coins != 1 {
+		t.Errorf("the player has %d coins, expected the landed one back", w.Player.Inventory.Coins)
+	}
+	if len(w.Coins) != 1 || w.Coins[0].Landed {
+		t.Errorf("coins left after picking up: %+v, expected the one still in the air", w.Coins)
+	}
+}
+
+// a corridor with the player at the west end facing east, and obstacle on the tile six
+// along from them
+func newThrowTestWorld(t *testing.T, obstacle string) *World {
+	t.Helper()
+	f := LevelFile{
+		Coins:  1,
+		Player: PlayerStart{Direction: "east"},
+		Tiles: []string{
+			"##########",
+			"#P.......#",
+			"##########",
+		},
+	}
+	if obstacle != "" {
+		row := []byte(f.Tiles[1])
+		row[7] = obstacle[0]
+		f.Tiles[1] = string(row)
+	}
+	return NewWorld(f, levelFromTestTiles(t, f), 1)
+}
+
+func TestThrowingUsesACoin(t *testing.T) {
+	w := newThrowTestWorld(t, "")
+
+	// charge for half a second, then let go
+	for tick := 0; tick < TickRate/2; tick++ {
+		w.Step(Input{Throw: true})
+	}
+	if want := coinThrowChargeSpeed / 2; math.Abs(w.ThrowCharge-want) > 1e-9 {
+		t.Errorf("charge is %g after half a second, expected %g", w.ThrowCharge, want)
+	}
+	w.Step(Input{})
+	if len(w.Coins) != 1 || w.Player.Inventory.Coins != 0 || w.CoinsUsed != 1 {
+		t.Fatalf("after throwing, %d coins are out, %d left and %d used, expected 1, 0 and 1", len(w.Coins), w.Player.Inventory.Coins, w.CoinsUsed)
+	}
+	if w.ThrowCharge != 0 {
+		t.Errorf("charge is %g after throwing, expected 0", w.ThrowCharge)
+	}
+
+	// with none left there's nothing to throw
+	w.Step(Input{Throw: true})
+	w.Step(Input{})
+	if len(w.Coins) != 1 || w.CoinsUsed != 1 {
+		t.Errorf("threw a coin without any left")
+	}
+}
+
+func TestThrowChargeSpeedsUpTheCoin(t *testing.T) {
+	w := newThrowTestWorld(t, "")
+	for _, test := range []struct {
+		charge, speed float64
+	}{
+		{0, coinThrowSpeedMin},
+		{1, coinThrowSpeedMax},
+	} {
+		w.ThrowCharge = test.charge
+		if coin := w.newThrownCoin(); math.Abs(coin.vx-test.speed) > 1e-9 || math.Abs(coin.vy) > 1e-9 {
+			t.Errorf("charge %g threw the coin at (%g, %g), expected (%g, 0)", test.charge, coin.vx, coin.vy, test.speed)
+		}
+	}
+}
+
+func TestThrownCoinsBounceOrStop(t *testing.T) {
+	tests := []struct {
+		obstacle string
+		bounces  bool
+	}{
+		{"#", true},
+		{"G", true},
+		{"D", true}, // closed
+		{"C", false},
+	}
+
+	for _, test := range tests {
+		w := newThrowTestWorld(t, test.obstacle)
+		w.ThrowCharge = 1
+		w.throwCoin()
+
+		// a full throw would carry the coin well past the obstacle
+		coin := &w.Coins[0]
+		furthest := coin.X
+		for tick := 0; tick < 5*TickRate && !coin.Landed; tick++ {
+			w.stepCoin(coin)
+			furthest = math.Max(furthest, coin.X)
+		}
+		if !coin.Landed {
+			t.Fatalf("%q: the coin never landed", test.obstacle)
+		}
+		if furthest >= 7 || furthest < 6.5 {
+			t.Errorf("%q: the coin got to x %g, expected it to reach the obstacle at 7 and go no further", test.obstacle, furthest)
+		}
+		if bounced := coin.X < furthest-1; bounced != test.bounces {
+			t.Errorf("%q: the coin landed at x %g after getting to %g, bounced is %v, expected %v", test.obstacle, coin.X, furthest, bounced, test.bounces)
+		}
+	}
+}
+
+func TestThrowPreviewShowsWhereTheCoinLands(t *testing.T) {
+	w := newThrowTestWorld(t, "#")
+	w.ThrowCharge = 0.7
+	w.Player.VerticalAngle = 0.2
+
+	preview := w.ThrowPreview()
+	last := preview[len(preview)-1]
+	if !last.Landed {
+		t.Fatal("the preview ran out before the coin landed")
+	}
+
+	w.throwCoin()
+	for i := 0; i < len(preview); i++ {
+		w.updateCoins()
+	}
+	if coin := w.Coins[0]; !coin.Landed || coin.X != last.X || coin.Y != last.Y {
+		t.Errorf("the coin came down at (%g, %g), the preview showed (%g, %g)", coin.X, coin.Y, last.X, last.Y)
+	}
+}
@@ -0,0 +1,148 @@
+package sim
+
+import "math"
+
+// -- doors
+
+const (
+	doorSpeed      float64 = 1.6          // of the door's width per second
+	doorCloseTicks int     = 3 * TickRate // how long a door an enemy opened stays open once nobody is in the doorway
+)
+
+// Door is a panel across the middle of a door tile, between the walls either side of
+// it, that slides into one of those walls as it opens
+type Door struct {
+	X, Y    int
+	Side    int     // 0 if the panel is crossed along x, 1 along y, like a ray's side
+	Open    float64 // how far the panel has slid, from 0 for closed to 1 for fully open
+	Opening bool    // which way the panel is sliding, or last slid once it has stopped
+	Keycard string  // colour of the keycard that unlocks it, empty once it's unlocked
+
+	closeTicks int // ticks until a door an enemy opened shuts itself behind them, 0 for doors left to the player
+}
+
+// anything short of fully open is in the way of people, sight and light
+func (d *Door) blocks() bool {
+	return d.Open < 1
+}
+
+// every door tile in the level, closed, and locked where the level file says so
+func (f LevelFile) doors(level Level) []Door {
+	var doors []Door
+	for y := 0; y < level.Height(); y++ {
+		for x := 0; x < level.Width(); x++ {
+			if level.EntityAt(x, y) != LevelEntity_Door {
+				continue
+			}
+			side, _ := level.doorSide(x, y)
+			door := Door{X: x, Y: y, Side: side}
+			for _, spawn := range f.Doors {
+				if spawn.X == x && spawn.Y == y {
+					door.Keycard = spawn.Keycard
+				}
+			}
+			doors = append(doors, door)
+		}
+	}
+	return doors
+}
+
+// which way a door's panel faces, from the walls either side of its tile. ok is false
+// when the tile isn't in a doorway
+func (l Level) doorSide(x, y int) (side int, ok bool) {
+	isWall := func(x, y int) bool {
+		return l.InBounds(x, y) && l.EntityAt(x, y) == LevelEntity_Wall
+	}
+	switch {
+	case isWall(x-1, y) && isWall(x+1, y):
+		// walls to the west and east, so the panel runs along x and is walked through along y
+		return 1, true
+	case isWall(x, y-1) && isWall(x, y+1):
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// the door on a tile, or nil if there isn't one
+func (w *World) DoorAt(x, y int) *Door {
+	if i, ok := w.doorIndex[[2]int{x, y}]; ok {
+		return &w.Doors[i]
+	}
+	return nil
+}
+
+// whether a tile has a door on it that isn't fully open
+func (w *World) isBlockedByDoor(x, y int) bool {
+	door := w.DoorAt(x, y)
+	return door != nil && door.blocks()
+}
+
+// whether the player or an enemy is standing on a tile, so a door there can't close
+func (w *World) isTileOccupied(x, y int) bool {
+	if int(w.Player.X) == x && int(w.Player.Y) == y {
+		return true
+	}
+	for _, e := range w.Enemies {
+		if int(e.X) == x && int(e.Y) == y {
+			return true
+		}
+	}
+	return false
+}
+
+// open a closed door, or close an open one. a locked door needs the player to hold its keycard
+func (w *World) useDoor(d *Door) {
+	if d.Opening {
+		if !w.isTileOccupied(d.X, d.Y) {
+			d.Opening = false
+			d.closeTicks = 0
+		}
+		return
+	}
+
+	if !w.Player.Inventory.Unlocks(d.Keycard) {
+		return
+	}
+	d.Keycard = ""
+	d.Opening = true
+	d.closeTicks = 0
+}
+
+// open a door for an enemy on its way through. enemies have keys, so locks don't stop them, but
+// unlike the player they don't leave doors open, locked or not
+func (w *World) openDoorForEnemy(d *Door) {
+	if d.Opening {
+		return
+	}
+	d.Opening = true
+	d.closeTicks = doorCloseTicks
+}
+
+// slide the doors towards open or closed. lights only shine through fully open doors, so the
+// light map changes whenever one opens all the way or starts to close
+func (w *World) updateDoors() {
+	changed := false
+	for i := range w.Doors {
+		d := &w.Doors[i]
+		blocked := d.blocks()
+		if d.Opening {
+			d.Open = math.Min(1, d.Open+doorSpeed*TickSeconds)
+		} else if !w.isTileOccupied(d.X, d.Y) {
+			d.Open = math.Max(0, d.Open-doorSpeed*TickSeconds)
+		}
+
+		// count down once it's fully open, starting over whenever someone is in the doorway
+		if d.closeTicks > 0 && d.Open == 1 {
+			if w.isTileOccupied(d.X, d.Y) {
+				d.closeTicks = doorCloseTicks
+			} else if d.closeTicks--; d.closeTicks == 0 {
+				d.Opening = false
+			}
+		}
+		changed = changed || d.blocks() != blocked
+	}
+	if changed {
+		w.updateLightMap()
+	}
+}
@@ -0,0 +1,192 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// two rooms joined by a door locked with the blue keycard, a guard in the top one and the
+// player in the bottom one without the keycard
+func newDoorTestWorld(t *testing.T) (*World, *Door) {
+	t.Helper()
+	f := LevelFile{
+		Tiles: []string{
+			"#######",
+			"#.....#",
+			"###D###",
+			"#.....#",
+			"#P...X#",
+			"#######",
+		},
+		Enemies: []EnemySpawn{{X: 1, Y: 1, Patrol: [][2]int{{1, 1}}}},
+		Doors:   []DoorSpawn{{X: 3, Y: 2, Keycard: "blue"}},
+	}
+	w := NewWorld(f, levelFromTestTiles(t, f), 1)
+	return w, w.DoorAt(3, 2)
+}
+
+// long enough for a door an enemy opened to wait and then slide shut
+var doorShutTicks = doorCloseTicks + int(math.Ceil(float64(TickRate)/doorSpeed))
+
+func TestEnemiesShutLockedDoorsBehindThem(t *testing.T) {
+	w, door := newDoorTestWorld(t)
+	enemy := &w.Enemies[0]
+
+	// walk the guard through the door into the bottom room
+	for tick := 0; ; tick++ {
+		if tick == 60*TickRate {
+			t.Fatal("the enemy never got through the door")
+		}
+		w.updateDoors()
+		if w.moveEnemyTowards(enemy, 3.5, 3.5) {
+			break
+		}
+	}
+	if door.Open != 1 {
+		t.Fatalf("the door is %g open as the enemy gets through, expected it to still be open", door.Open)
+	}
+
+	for tick := 0; tick < doorShutTicks; tick++ {
+		w.updateDoors()
+	}
+	if door.Open != 0 || door.Opening {
+		t.Errorf("the door is %g open and opening is %v after the enemy went through, expected it shut", door.Open, door.Opening)
+	}
+	if door.Keycard != "blue" {
+		t.Errorf("the door's keycard is %q after the enemy went through, expected it still locked with blue", door.Keycard)
+	}
+
+	w.useDoor(door)
+	if door.Opening {
+		t.Error("the player opened the locked door without its keycard")
+	}
+}
+
+func TestEnemyOpenedDoorsStayOpenWhileSomeoneIsInTheDoorway(t *testing.T) {
+	w, door := newDoorTestWorld(t)
+	w.openDoorForEnemy(door)
+	w.Player.X, w.Player.Y = 3.5, 2.5
+
+	for tick := 0; tick < doorShutTicks*2; tick++ {
+		w.updateDoors()
+	}
+	if door.Open != 1 || !door.Opening {
+		t.Errorf("the door is %g open and opening is %v with the player in the doorway, expected it held open", door.Open, door.Opening)
+	}
+
+	// the player stepping out lets it shut
+	w.Player.X, w.Player.Y = 3.5, 3.5
+	for tick := 0; tick < doorShutTicks; tick++ {
+		w.updateDoors()
+	}
+	if door.Open != 0 {
+		t.Errorf("the door is %g open long after the player left the doorway, expected it shut", door.Open)
+	}
+}
+
+func TestPlayerOpenedDoorsStayOpen(t *testing.T) {
+	w, door := newDoorTestWorld(t)
+	w.Player.Inventory.Keycards = []string{"blue"}
+	w.useDoor(door)
+
+	for tick := 0; tick < doorShutTicks*2; tick++ {
+		w.updateDoors()
+	}
+	if door.Open != 1 {
+		t.Errorf("the door the player opened is %g open, expected it left open", door.Open)
+	}
+}
+
+func TestClosedDoorsMuffleNoise(t *testing.T) {
+	w, door := newDoorTestWorld(t)
+	noise := Noise{x: 3.5, y: 1.5, radius: 4}
+	below := 3*w.Level.Width() + 3
+
+	if loudness := w.propagateNoise(noise)[below]; loudness != 0 {
+		t.Errorf("a noise two tiles away through the closed door is %g loud, expected it muffled to 0", loudness)
+	}
+	door.Open = 1
+	if loudness := w.propagateNoise(noise)[below]; loudness != 0.5 {
+		t.Errorf("a noise two tiles away through the open door is %g loud, expected 0.5", loudness)
+	}
+}
+
+func TestPlayerUnlocksOpensAndClosesDoors(t *testing.T) {
+	w, door := newDoorTestWorld(t)
+	w.Player.X, w.Player.Y = 3.5, 3.5
+	w.Player.DirX, w.Player.DirY = 0, -1
+	slide := func() {
+		for tick := 0; tick < doorShutTicks; tick++ {
+			w.updateDoors()
+		}
+	}
+
+	w.interact()
+	if door.Opening || door.Keycard != "blue" {
+		t.Fatal("the player opened the locked door without its keycard")
+	}
+
+	w.Player.Inventory.Keycards = []string{"blue"}
+	w.interact()
+	slide()
+	if door.Open != 1 || door.Keycard != "" {
+		t.Fatalf("with the keycard the door is %g open and locked with %q, expected it open and unlocked", door.Open, door.Keycard)
+	}
+	if w.playerCollision(3.5, 2.5) {
+		t.Error("the open door is in the player's way")
+	}
+
+	// it won't close on the player standing in the doorway
+	w.Player.Y = 2.5
+	w.interact()
+	slide()
+	if door.Open != 1 {
+		t.Errorf("the door closed on the player, it's %g open", door.Open)
+	}
+
+	w.Player.Y = 3.5
+	w.interact()
+	slide()
+	if door.Open != 0 || !w.playerCollision(3.5, 2.5) {
+		t.Errorf("the door is %g open after closing it, expected it shut and in the way", door.Open)
+	}
+
+	// once unlocked it stays unlocked
+	w.Player.Inventory.Keycards = nil
+	w.interact()
+	if !door.Opening {
+		t.Error("the player couldn't open the door they had unlocked")
+	}
+}
+
+func TestClosingDoorsWaitForTheDoorway(t *testing.T) {
+	w, door := newDoorTestWorld(t)
+	door.Open = 0.5
+	w.Player.X, w.Player.Y = 3.5, 2.5
+
+	w.updateDoors()
+	if door.Open != 0.5 {
+		t.Errorf("the door slid to %g open with the player in the doorway, expected it held at 0.5", door.Open)
+	}
+	w.Player.Y = 3.5
+	w.updateDoors()
+	if door.Open >= 0.5 {
+		t.Errorf("the door is %g open once the doorway was clear, expected it closing", door.Open)
+	}
+}
+
+func TestClosedDoorsBlockSight(t *testing.T) {
+	w, door := newDoorTestWorld(t)
+	enemy := &w.Enemies[0]
+	enemy.X, enemy.Y = 3.5, 1.5
+	enemy.DirX, enemy.DirY = 0, 1
+	w.Player.X, w.Player.Y = 3.5, 3.5
+
+	if w.canEnemySeePlayer(enemy) {
+		t.Error("the enemy can see the player through the closed door")
+	}
+	door.Open = 1
+	if !w.canEnemySeePlayer(enemy) {
+		t.Error("the enemy can't see the player through the open door")
+	}
+}
@@ -0,0 +1,440 @@
+package sim
+
+import "math"
+
+// -- enemy
+
+type Enemy struct {
+	X, Y             float64
+	DirX, DirY       float64
+	patrolPoints     []PatrolPoint
+	currentPoint     int
+	speed            float64
+	FOVAngle         float64
+	FOVDistance      float64
+	Suspicion        float64 // 0 is unaware, 1 means the player has been caught
+	hearingThreshold float64
+	baseSpeed        float64 // speed and field of vision while patrolling, scaled per state
+	baseFOVAngle     float64
+	baseFOVDistance  float64
+	State            EnemyState
+	stateTicks       int           // ticks spent in the current state
+	searchTurn       float64       // 1 or -1, which way to turn while looking around
+	target           PatrolPoint   // point of interest or last known player position
+	searchPoints     []PatrolPoint // spots around the target to check while searching
+	path             []PatrolPoint // remaining tile centres on the way to pathGoal
+	pathGoal         pathKey
+}
+
+type EnemyState int
+
+const (
+	EnemyState_Patrol EnemyState = iota
+	EnemyState_Investigate
+	EnemyState_Chase
+	EnemyState_Search
+	EnemyState_Return
+)
+
+func (s EnemyState) String() string {
+	switch s {
+	case EnemyState_Patrol:
+		return "patrol"
+	case EnemyState_Investigate:
+		return "investigate"
+	case EnemyState_Chase:
+		return "chase"
+	case EnemyState_Search:
+		return "search"
+	case EnemyState_Return:
+		return "return"
+	default:
+		return "unknown"
+	}
+}
+
+// multipliers applied to the enemy's base speed and field of vision in each state
+type EnemyStateSettings struct {
+	speed       float64
+	fovAngle    float64
+	fovDistance float64
+}
+
+var enemyStateSettings = map[EnemyState]EnemyStateSettings{
+	EnemyState_Patrol:      {speed: 1, fovAngle: 1, fovDistance: 1},
+	EnemyState_Investigate: {speed: 1.5, fovAngle: 1.2, fovDistance: 1.2},
+	EnemyState_Chase:       {speed: 3.5, fovAngle: 1.5, fovDistance: 1.4},
+	EnemyState_Search:      {speed: 1.2, fovAngle: 1.5, fovDistance: 1.2},
+	EnemyState_Return:      {speed: 1, fovAngle: 1, fovDistance: 1},
+}
+
+// EnemyType is the base speed, field of vision and hearing of a kind of enemy while patrolling
+type EnemyType struct {
+	speed            float64
+	fovAngle         float64
+	fovDistance      float64
+	hearingThreshold float64
+}
+
+const defaultEnemyType = "guard"
+
+var enemyTypes = map[string]EnemyType{
+	"guard":    {speed: 0.6, fovAngle: math.Pi / 3, fovDistance: 5, hearingThreshold: enemyHearingThreshold},
+	"manager":  {speed: 0.42, fovAngle: math.Pi / 2, fovDistance: 4, hearingThreshold: 0.2},
+	"security": {speed: 0.84, fovAngle: math.Pi / 4, fovDistance: 7, hearingThreshold: 0.05},
+}
+
+const (
+	enemyChaseSuspicion  float64 = 0.5 // suspicion at which a seen player is chased rather than looked at
+	enemySearchDuration  float64 = 5   // seconds spent searching before giving up
+	enemySearchTurnSpeed float64 = 1.8 // radians per second
+)
+
+func (w *World) initializeEnemies(spawns []EnemySpawn) {
+	for _, spawn := range spawns {
+		typeName := spawn.Type
+		if typeName == "" {
+			typeName = defaultEnemyType
+		}
+		enemyType := enemyTypes[typeName]
+
+		x, y := float64(spawn.X)+0.5, float64(spawn.Y)+0.5
+		enemy := Enemy{
+			X:                x,
+			Y:                y,
+			DirX:             1,
+			DirY:             0,
+			patrolPoints:     generatePatrolPoints(w.Level, x, y),
+			currentPoint:     0,
+			hearingThreshold: enemyType.hearingThreshold,
+			baseSpeed:        enemyType.speed,
+			baseFOVAngle:     enemyType.fovAngle,
+			baseFOVDistance:  enemyType.fovDistance,
+		}
+
+		if len(spawn.Patrol) > 0 {
+			enemy.patrolPoints = make([]PatrolPoint, len(spawn.Patrol))
+			for i, point := range spawn.Patrol {
+				enemy.patrolPoints[i] = PatrolPoint{float64(point[0]) + 0.5, float64(point[1]) + 0.5}
+			}
+		}
+		if spawn.FOVAngle > 0 {
+			enemy.baseFOVAngle = spawn.FOVAngle * math.Pi / 180
+		}
+		if spawn.FOVDistance > 0 {
+			enemy.baseFOVDistance = spawn.FOVDistance
+		}
+
+		enemy.setState(EnemyState_Patrol)
+		w.Enemies = append(w.Enemies, enemy)
+	}
+}
+
+type PatrolPoint struct {
+	x, y float64
+}
+
+func generatePatrolPoints(level Level, startX, startY float64) []PatrolPoint {
+	// todo: do something more interesting here
+	points := []PatrolPoint{
+		{startX, startY},
+		{startX + 1, startY},
+		{startX + 2, startY + 2},
+		{startX, startY + 2},
+	}
+
+	// validate points (make sure they're not walls or constructs)
+	validPoints := make([]PatrolPoint, 0)
+	for _, p := range points {
+		if level.isWalkable(int(p.x), int(p.y)) {
+			validPoints = append(validPoints, p)
+		}
+	}
+
+	return validPoints
+}
+
+// switch state, applying that state's speed and field of vision
+func (e *Enemy) setState(state EnemyState) {
+	settings := enemyStateSettings[state]
+	e.State = state
+	e.stateTicks = 0
+	e.speed = e.baseSpeed * settings.speed
+	e.FOVAngle = math.Min(2*math.Pi, e.baseFOVAngle*settings.fovAngle)
+	e.FOVDistance = e.baseFOVDistance * settings.fovDistance
+}
+
+func (w *World) updateEnemy(e *Enemy, seesPlayer bool) {
+	e.stateTicks++
+
+	// seeing the player overrides whatever the enemy was doing
+	if seesPlayer {
+		e.target = PatrolPoint{w.Player.X, w.Player.Y}
+		if e.Suspicion >= enemyChaseSuspicion {
+			if e.State != EnemyState_Chase {
+				e.setState(EnemyState_Chase)
+			}
+		} else if e.State != EnemyState_Investigate && e.State != EnemyState_Chase {
+			e.setState(EnemyState_Investigate)
+		}
+	}
+
+	switch e.State {
+	case EnemyState_Patrol:
+		w.updateEnemyPatrol(e)
+	case EnemyState_Investigate:
+		w.updateEnemyInvestigate(e)
+	case EnemyState_Chase:
+		w.updateEnemyChase(e, seesPlayer)
+	case EnemyState_Search:
+		w.updateEnemySearch(e)
+	case EnemyState_Return:
+		w.updateEnemyReturn(e)
+	}
+}
+
+// walk the patrol route
+func (w *World) updateEnemyPatrol(e *Enemy) {
+	if len(e.patrolPoints) == 0 {
+		return
+	}
+	point := e.patrolPoints[e.currentPoint]
+	if w.moveEnemyTowards(e, point.x, point.y) {
+		// reached the current patrol point, move to the next one
+		e.currentPoint = (e.currentPoint + 1) % len(e.patrolPoints)
+	}
+}
+
+// walk to the point of interest, then search around it
+func (w *World) updateEnemyInvestigate(e *Enemy) {
+	if w.moveEnemyTowards(e, e.target.x, e.target.y) {
+		w.startEnemySearch(e)
+	}
+}
+
+// follow the player while they're in sight, then search where they were last seen
+func (w *World) updateEnemyChase(e *Enemy, seesPlayer bool) {
+	w.moveEnemyTowards(e, e.target.x, e.target.y)
+	if !seesPlayer {
+		e.setState(EnemyState_Search)
+		e.searchPoints = nil
+	}
+}
+
+// head to the last known position, then check the spots around it while looking around
+func (w *World) updateEnemySearch(e *Enemy) {
+	if float64(e.stateTicks)*TickSeconds > enemySearchDuration {
+		e.setState(EnemyState_Return)
+		return
+	}
+
+	if e.searchPoints == nil {
+		if w.moveEnemyTowards(e, e.target.x, e.target.y) {
+			w.startEnemySearch(e)
+		}
+		return
+	}
+
+	if len(e.searchPoints) == 0 {
+		w.rotateEnemy(e, e.searchTurn*enemySearchTurnSpeed*TickSeconds)
+		return
+	}
+
+	point := e.searchPoints[0]
+	if w.moveEnemyTowards(e, point.x, point.y) {
+		e.searchPoints = e.searchPoints[1:]
+	}
+}
+
+func (w *World) startEnemySearch(e *Enemy) {
+	e.setState(EnemyState_Search)
+	e.searchPoints = generatePatrolPoints(w.Level, e.target.x, e.target.y)
+
+	// look around one way or the other, so searches aren't all the same
+	e.searchTurn = 1
+	if w.rng.Intn(2) == 0 {
+		e.searchTurn = -1
+	}
+}
+
+// walk back to the nearest point of the patrol route and resume patrolling
+func (w *World) updateEnemyReturn(e *Enemy) {
+	if len(e.patrolPoints) == 0 {
+		e.setState(EnemyState_Patrol)
+		return
+	}
+
+	if e.stateTicks == 1 {
+		e.currentPoint = nearestPatrolPoint(e.patrolPoints, e.X, e.Y)
+	}
+
+	point := e.patrolPoints[e.currentPoint]
+	if w.moveEnemyTowards(e, point.x, point.y) {
+		e.setState(EnemyState_Patrol)
+	}
+}
+
+// move the enemy a step along the path to a point. returns true once the point is reached,
+// or if it can't be reached at all so the enemy moves on to something else
+func (w *World) moveEnemyTowards(e *Enemy, targetX, targetY float64) bool {
+	fromX, fromY := int(e.X), int(e.Y)
+	toX, toY := int(targetX), int(targetY)
+
+	// same tile, nothing in the way
+	if fromX == toX && fromY == toY {
+		e.path = nil
+		return w.stepEnemyTowards(e, targetX, targetY)
+	}
+
+	if e.path == nil || e.pathGoal.toX != toX || e.pathGoal.toY != toY {
+		path := w.paths.find(fromX, fromY, toX, toY)
+		if path == nil {
+			return true
+		}
+		e.path = path
+		e.pathGoal = pathKey{fromX, fromY, toX, toY}
+	}
+
+	// open closed doors on the way and wait for them
+	waypoint := e.path[0]
+	if door := w.DoorAt(int(waypoint.x), int(waypoint.y)); door != nil && door.blocks() {
+		w.openDoorForEnemy(door)
+		return false
+	}
+
+	if w.stepEnemyTowards(e, waypoint.x, waypoint.y) {
+		e.path = e.path[1:]
+		if len(e.path) == 0 {
+			e.path = nil
+		}
+	}
+	return false
+}
+
+// move the enemy in a straight line towards a point, facing it. returns true once the point is reached
+func (w *World) stepEnemyTowards(e *Enemy, targetX, targetY float64) bool {
+	dx, dy := targetX-e.X, targetY-e.Y
+	dist := math.Sqrt(dx*dx + dy*dy)
+
+	step := e.speed * TickSeconds
+	if dist < step {
+		e.X, e.Y = targetX, targetY
+		return true
+	}
+
+	e.X += (dx / dist) * step
+	e.Y += (dy / dist) * step
+
+	// update direction
+	e.DirX, e.DirY = dx/dist, dy/dist
+	return false
+}
+
+func (w *World) rotateEnemy(e *Enemy, angle float64) {
+	oldDirX := e.DirX
+	e.DirX = e.DirX*math.Cos(angle) - e.DirY*math.Sin(angle)
+	e.DirY = oldDirX*math.Sin(angle) + e.DirY*math.Cos(angle)
+}
+
+func nearestPatrolPoint(points []PatrolPoint, x, y float64) int {
+	nearest := 0
+	nearestDist := math.Inf(1)
+	for i, p := range points {
+		dx, dy := p.x-x, p.y-y
+		if dist := dx*dx + dy*dy; dist < nearestDist {
+			nearest, nearestDist = i, dist
+		}
+	}
+	return nearest
+}
+
+const (
+	suspicionRiseMin          float64 = 0.3  // per second, at the edge of the enemy's vision
+	suspicionRiseMax          float64 = 2.4  // per second, right in front of the enemy
+	suspicionFall             float64 = 0.18 // per second, while the player is out of sight
+	suspicionCrouchMultiplier float64 = 0.4
+)
+
+// raise the enemy's suspicion while it can see the player and let it fall otherwise.
+// returns whether the player was seen this tick.
+func (w *World) updateEnemySuspicion(e *Enemy) bool {
+	if !w.canEnemySeePlayer(e) {
+		e.Suspicion = math.Max(0, e.Suspicion-suspicionFall*TickSeconds)
+		return false
+	}
+
+	dx, dy := w.Player.X-e.X, w.Player.Y-e.Y
+	proximity := 1 - math.Min(1, math.Sqrt(dx*dx+dy*dy)/w.sightDistance(e))
+
+	rise := suspicionRiseMin + (suspicionRiseMax-suspicionRiseMin)*proximity
+	if w.Player.IsCrouching {
+		rise *= suspicionCrouchMultiplier
+	}
+	if w.Player.Inventory.Disguised {
+		rise *= disguiseSuspicionMultiplier
+	}
+
+	e.Suspicion = math.Min(1, e.Suspicion+rise*TickSeconds)
+	return true
+}
+
+func (w *World) canEnemySeePlayer(enemy *Enemy) bool {
+	// calculate angle and distance between enemy and player
+	dx := w.Player.X - enemy.X
+	dy := w.Player.Y - enemy.Y
+	distToPlayer := math.Sqrt(dx*dx + dy*dy)
+	angleToPlayer := math.Atan2(dy, dx)
+
+	// check if player is within enemy's fov and range
+	enemyAngle := math.Atan2(enemy.DirY, enemy.DirX)
+	angleDiff := math.Abs(angleToPlayer - enemyAngle)
+	if angleDiff > math.Pi {
+		angleDiff = 2*math.Pi - angleDiff
+	}
+
+	// the player is harder to make out in the dark
+	if distToPlayer <= w.sightDistance(enemy) && angleDiff <= enemy.FOVAngle/2 {
+		// check if there's a clear line of sight
+		steps := int(distToPlayer * 100) // change to adjust precision
+		lastCoverHeight := 0.0
+
+		for i := 0; i <= steps; i++ {
+			t := float64(i) / float64(steps)
+			checkX := enemy.X + t*dx
+			checkY := enemy.Y + t*dy
+			checkTileX, checkTileY := int(checkX), int(checkY)
+
+			// check for out of bounds
+			if checkTileX < 0 || checkTileX >= w.Level.Width() || checkTileY < 0 || checkTileY >= w.Level.Height() {
+				return false
+			}
+
+			tile := w.Level.TileAt(checkTileX, checkTileY)
+
+			// if we hit a wall or a door that isn't fully open, enemy can't see player. glass
+			// is seen straight through, and is too tall to hide a crouching player like a construct
+			if !tile.SeeThrough || w.isBlockedByDoor(checkTileX, checkTileY) {
+				return false
+			}
+
+			// if we hit a construct or other cover
+			if tile.isCover() {
+				lastCoverHeight = tile.Height
+
+				// if this is the last step (player's position) and player is crouching
+				if i == steps && w.Player.IsCrouching {
+					return false // player is hidden behind the cover
+				}
+			}
+
+			// we've reached the player's position
+			if checkTileX == int(w.Player.X) && checkTileY == int(w.Player.Y) {
+				if w.Player.IsCrouching && lastCoverHeight > 0 {
+					return false // player is crouching and there was cover in the line of sight
+				}
+				return true // player can be seen
+			}
+		}
+	}
+	return false
+}
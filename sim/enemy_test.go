@@ -0,0 +1,119 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// a fully lit room with one guard at the east end looking west along the middle row, the
+// player standing dist tiles in front of it, and middle in the tile between them
+func newSightTestWorld(t *testing.T, dist int, middle string) (*World, *Enemy) {
+	t.Helper()
+	f := LevelFile{
+		Tiles: []string{
+			"##########",
+			"#........#",
+			"#P.......#",
+			"#........#",
+			"#X.......#",
+			"##########",
+		},
+		Enemies: []EnemySpawn{{X: 8, Y: 2, Patrol: [][2]int{{8, 2}}}},
+	}
+	if middle != "" {
+		row := []byte(f.Tiles[2])
+		row[8-dist/2] = middle[0]
+		f.Tiles[2] = string(row)
+	}
+
+	w := newTestWorld(t, f, 1)
+	w.Player.X, w.Player.Y = float64(8-dist)+0.5, 2.5
+	enemy := &w.Enemies[0]
+	enemy.DirX, enemy.DirY = -1, 0
+	return w, enemy
+}
+
+func TestSuspicionRisesInSight(t *testing.T) {
+	w, enemy := newSightTestWorld(t, 4, "")
+	if !w.updateEnemySuspicion(enemy) {
+		t.Fatal("the enemy can't see the player in front of it")
+	}
+
+	proximity := 1 - 4/w.sightDistance(enemy)
+	want := (suspicionRiseMin + (suspicionRiseMax-suspicionRiseMin)*proximity) * TickSeconds
+	if math.Abs(enemy.Suspicion-want) > 1e-9 {
+		t.Errorf("suspicion is %g after a tick, expected %g", enemy.Suspicion, want)
+	}
+}
+
+func TestSuspicionRisesFasterUpClose(t *testing.T) {
+	near, nearEnemy := newSightTestWorld(t, 2, "")
+	far, farEnemy := newSightTestWorld(t, 4, "")
+	near.updateEnemySuspicion(nearEnemy)
+	far.updateEnemySuspicion(farEnemy)
+	if nearEnemy.Suspicion <= farEnemy.Suspicion {
+		t.Errorf("suspicion rose by %g up close and %g further away", nearEnemy.Suspicion, farEnemy.Suspicion)
+	}
+}
+
+func TestSuspicionRisesSlowerWhileCrouching(t *testing.T) {
+	standing, standingEnemy := newSightTestWorld(t, 4, "")
+	crouching, crouchingEnemy := newSightTestWorld(t, 4, "")
+	crouching.Player.IsCrouching = true
+	standing.updateEnemySuspicion(standingEnemy)
+	crouching.updateEnemySuspicion(crouchingEnemy)
+
+	want := standingEnemy.Suspicion * suspicionCrouchMultiplier
+	if math.Abs(crouchingEnemy.Suspicion-want) > 1e-9 {
+		t.Errorf("crouching suspicion is %g, expected %g", crouchingEnemy.Suspicion, want)
+	}
+}
+
+func TestSuspicionFallsOutOfSight(t *testing.T) {
+	w, enemy := newSightTestWorld(t, 4, "")
+	enemy.DirX = 1 // looking away
+	enemy.Suspicion = 0.5
+	if w.updateEnemySuspicion(enemy) {
+		t.Fatal("the enemy can see the player behind it")
+	}
+	if want := 0.5 - suspicionFall*TickSeconds; math.Abs(enemy.Suspicion-want) > 1e-9 {
+		t.Errorf("suspicion is %g after a tick, expected %g", enemy.Suspicion, want)
+	}
+
+	for i := 0; i < 10*TickRate; i++ {
+		w.updateEnemySuspicion(enemy)
+	}
+	if enemy.Suspicion != 0 {
+		t.Errorf("suspicion is %g long after losing sight, expected 0", enemy.Suspicion)
+	}
+}
+
+func TestSuspicionIsOutOfRange(t *testing.T) {
+	w, enemy := newSightTestWorld(t, 7, "")
+	enemy.FOVDistance = 3
+	if w.updateEnemySuspicion(enemy) {
+		t.Error("the enemy can see the player beyond its field of vision")
+	}
+}
+
+func TestSightThroughTiles(t *testing.T) {
+	tests := []struct {
+		middle    string
+		crouching bool
+		seen      bool
+	}{
+		{middle: "#", seen: false},
+		{middle: "G", seen: true},
+		{middle: "G", crouching: true, seen: true},
+		{middle: "C", seen: true},
+		{middle: "C", crouching: true, seen: false},
+	}
+
+	for _, test := range tests {
+		w, enemy := newSightTestWorld(t, 4, test.middle)
+		w.Player.IsCrouching = test.crouching
+		if seen := w.canEnemySeePlayer(enemy); seen != test.seen {
+			t.Errorf("through %q, crouching %v: seen is %v, expected %v", test.middle, test.crouching, seen, test.seen)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package sim
+
+import "image/color"
+
+// -- inventory
+
+const (
+	pickupRadius                float64 = 0.5
+	disguiseSuspicionMultiplier float64 = 0.35 // of the usual rate suspicion of a disguised player rises at
+)
+
+// Inventory is everything the player is carrying
+type Inventory struct {
+	Coins     int      // to throw
+	Keycards  []string // colours, in the order they were picked up
+	Disguised bool     // wearing a disguise, until an enemy sees through it and gives chase
+}
+
+// whether the inventory holds the keycard a lock needs. anything without a lock needs none
+func (inv Inventory) Unlocks(keycard string) bool {
+	if keycard == "" {
+		return true
+	}
+	for _, held := range inv.Keycards {
+		if held == keycard {
+			return true
+		}
+	}
+	return false
+}
+
+type PickupKind int
+
+const (
+	PickupKind_Keycard PickupKind = iota
+	PickupKind_Coins
+	PickupKind_Disguise
+)
+
+func (k PickupKind) String() string {
+	switch k {
+	case PickupKind_Keycard:
+		return "keycard"
+	case PickupKind_Coins:
+		return "coins"
+	case PickupKind_Disguise:
+		return "disguise"
+	default:
+		return "unknown"
+	}
+}
+
+var pickupKindNames = map[string]PickupKind{
+	"keycard":  PickupKind_Keycard,
+	"coins":    PickupKind_Coins,
+	"disguise": PickupKind_Disguise,
+}
+
+// KeycardColors are the colours keycards come in, and the colour each is drawn in
+var KeycardColors = map[string]color.RGBA{
+	"red":    {210, 50, 50, 255},
+	"green":  {60, 180, 80, 255},
+	"blue":   {60, 120, 220, 255},
+	"yellow": {230, 200, 50, 255},
+}
+
+// Pickup is an item lying on the floor until the player walks over it
+type Pickup struct {
+	X, Y  float64
+	Kind  PickupKind
+	Color string // keycards only
+	Count int    // coins only
+}
+
+// the pickups described by the level file, in the middle of their tiles
+func (f LevelFile) pickups() []Pickup {
+	pickups := make([]Pickup, len(f.Pickups))
+	for i, spawn := range f.Pickups {
+		pickups[i] = Pickup{
+			X:     float64(spawn.X) + 0.5,
+			Y:     float64(spawn.Y) + 0.5,
+			Kind:  pickupKindNames[spawn.Type],
+			Color: spawn.Color,
+			Count: 1,
+		}
+		if spawn.Count > 0 {
+			pickups[i].Count = spawn.Count
+		}
+	}
+	return pickups
+}
+
+// the player takes any item they walk over. a second keycard of a colour they already
+// hold is left where it is
+func (w *World) pickUpItems() {
+	remaining := w.Pickups[:0]
+	for _, p := range w.Pickups {
+		dx, dy := p.X-w.Player.X, p.Y-w.Player.Y
+		if dx*dx+dy*dy <= pickupRadius*pickupRadius && w.Player.Inventory.add(p) {
+			continue
+		}
+		remaining = append(remaining, p)
+	}
+	w.Pickups = remaining
+}
+
+// put a pickup in the inventory, returning false if there's no use for it
+func (inv *Inventory) add(p Pickup) bool {
+	switch p.Kind {
+	case PickupKind_Keycard:
+		if inv.Unlocks(p.Color) {
+			return false
+		}
+		inv.Keycards = append(inv.Keycards, p.Color)
+	case PickupKind_Coins:
+		inv.Coins += p.Count
+	case PickupKind_Disguise:
+		if inv.Disguised {
+			return false
+		}
+		inv.Disguised = true
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPlayerPicksUpItems(t *testing.T) {
+	f := LevelFile{
+		Tiles: []string{
+			"#########",
+			"#P.....X#",
+			"#########",
+		},
+		Pickups: []PickupSpawn{
+			{X: 2, Y: 1, Type: "keycard", Color: "red"},
+			{X: 3, Y: 1, Type: "keycard", Color: "red"},
+			{X: 4, Y: 1, Type: "coins", Count: 3},
+			{X: 5, Y: 1, Type: "disguise"},
+			{X: 6, Y: 1, Type: "disguise"},
+		},
+	}
+	w := NewWorld(f, levelFromTestTiles(t, f), 1)
+
+	for x := 2; x <= 6; x++ {
+		w.Player.X = float64(x) + 0.5
+		w.pickUpItems()
+	}
+	inv := w.Player.Inventory
+	if len(inv.Keycards) != 1 || inv.Keycards[0] != "red" || inv.Coins != 3 || !inv.Disguised {
+		t.Errorf("inventory is %+v, expected the red keycard, 3 coins and a disguise", inv)
+	}
+
+	// a second red keycard and a second disguise are no use, so they're left lying there
+	if len(w.Pickups) != 2 || w.Pickups[0].X != 3.5 || w.Pickups[1].X != 6.5 {
+		t.Errorf("pickups left are %+v, expected the second keycard and disguise", w.Pickups)
+	}
+}
+
+func TestItemsOutOfReachStayPut(t *testing.T) {
+	f := LevelFile{
+		Tiles:   []string{"#####", "#P..#", "#####"},
+		Pickups: []PickupSpawn{{X: 3, Y: 1, Type: "coins"}},
+	}
+	w := NewWorld(f, levelFromTestTiles(t, f), 1)
+
+	w.Player.X = 3.5 - pickupRadius - 0.01
+	w.pickUpItems()
+	if len(w.Pickups) != 1 || w.Player.Inventory.Coins != 0 {
+		t.Error("picked up coins from out of reach")
+	}
+}
+
+func TestLockedExitsNeedTheirKeycard(t *testing.T) {
+	f := LevelFile{
+		Player: PlayerStart{Direction: "east"},
+		Tiles: []string{
+			"#####",
+			"#P.X#",
+			"#####",
+		},
+		Exits: []ExitSpawn{{X: 3, Y: 1, Keycard: "red"}},
+	}
+	w := NewWorld(f, levelFromTestTiles(t, f), 1)
+
+	for tick := 0; tick < 2*TickRate; tick++ {
+		w.Step(Input{Forward: true})
+	}
+	if int(w.Player.X) != 3 {
+		t.Fatalf("the player got to x %g, expected onto the exit", w.Player.X)
+	}
+	if w.Outcome != Outcome_Playing {
+		t.Fatalf("outcome is %d on the exit without its keycard, expected the run to carry on", w.Outcome)
+	}
+
+	w.Player.Inventory.Keycards = []string{"blue", "red"}
+	w.Step(Input{})
+	if w.Outcome != Outcome_Escaped {
+		t.Errorf("outcome is %d on the exit with its keycard, expected escaped", w.Outcome)
+	}
+}
+
+func TestDisguiseSlowsSuspicionUntilAChase(t *testing.T) {
+	plain, plainEnemy := newSightTestWorld(t, 4, "")
+	disguised, disguisedEnemy := newSightTestWorld(t, 4, "")
+	disguised.Player.Inventory.Disguised = true
+	plain.updateEnemySuspicion(plainEnemy)
+	disguised.updateEnemySuspicion(disguisedEnemy)
+
+	want := plainEnemy.Suspicion * disguiseSuspicionMultiplier
+	if math.Abs(disguisedEnemy.Suspicion-want) > 1e-9 {
+		t.Errorf("disguised suspicion is %g, expected %g", disguisedEnemy.Suspicion, want)
+	}
+
+	disguisedEnemy.setState(EnemyState_Chase)
+	disguised.Step(Input{})
+	if disguised.Player.Inventory.Disguised {
+		t.Error("the player is still disguised with an enemy chasing them")
+	}
+}
@@ -0,0 +1,178 @@
+package sim
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"io/fs"
+)
+
+// -- level
+
+type LevelEntity int
+
+const (
+	LevelEntity_Empty LevelEntity = iota
+	LevelEntity_Wall
+	LevelEntity_Enemy
+	LevelEntity_Exit
+	LevelEntity_Player
+	LevelEntity_Construct
+	LevelEntity_Door
+	LevelEntity_Glass
+)
+
+type LevelEntityColor = color.RGBA
+
+var (
+	LevelEntityColor_Empty     = color.RGBA{255, 255, 255, 255}
+	LevelEntityColor_Wall      = color.RGBA{0, 0, 0, 255}
+	LevelEntityColor_Enemy     = color.RGBA{255, 0, 0, 255}
+	LevelEntityColor_Exit      = color.RGBA{0, 255, 0, 255}
+	LevelEntityColor_Player    = color.RGBA{0, 0, 255, 255}
+	LevelEntityColor_Construct = color.RGBA{255, 255, 0, 255}
+	LevelEntityColor_Door      = color.RGBA{128, 64, 0, 255}
+	LevelEntityColor_Glass     = color.RGBA{0, 255, 255, 255}
+)
+
+// TileProperties are how a tile behaves. its entity decides them, unless the level
+// file's legend overrides them
+type TileProperties struct {
+	Height     float64 // tiles, as drawn
+	Solid      bool    // in the way of the player, enemies and thrown coins
+	SeeThrough bool    // enemies can see and lights shine past it
+}
+
+const coverHeight float64 = 1 // tiles, solid tiles lower than this are cover to crouch behind rather than a barrier
+
+var defaultTileProperties = map[LevelEntity]TileProperties{
+	LevelEntity_Empty:     {Height: 0, SeeThrough: true},
+	LevelEntity_Wall:      {Height: 2, Solid: true},
+	LevelEntity_Enemy:     {Height: 0, SeeThrough: true},
+	LevelEntity_Exit:      {Height: 1, SeeThrough: true},
+	LevelEntity_Player:    {Height: 0, SeeThrough: true},
+	LevelEntity_Construct: {Height: 0.8, Solid: true, SeeThrough: true},
+	LevelEntity_Door:      {Height: 2, SeeThrough: true}, // the door's panel is in the way until it opens
+	LevelEntity_Glass:     {Height: 2, Solid: true, SeeThrough: true},
+}
+
+// DefaultTileProperties are the properties of an entity's tiles when nothing overrides them
+func DefaultTileProperties(entity LevelEntity) TileProperties {
+	return defaultTileProperties[entity]
+}
+
+// Tile is one square of a level
+type Tile struct {
+	Entity LevelEntity
+	TileProperties
+}
+
+func newTile(entity LevelEntity) Tile {
+	return Tile{Entity: entity, TileProperties: DefaultTileProperties(entity)}
+}
+
+// a solid tile low enough to crouch behind, and for a thrown coin to come to rest against
+func (t Tile) isCover() bool {
+	return t.Solid && t.Height < coverHeight
+}
+
+type Level [][]Tile
+
+// NewLevel imports a level from a colour-coded image, one pixel per tile. pixels of
+// any other colour are reported as LevelErrors and left empty.
+func NewLevel(file fs.File) (Level, error) {
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	level, errs := levelFromImage(img)
+	if len(errs) > 0 {
+		return level, errs
+	}
+	return level, nil
+}
+
+func levelFromImage(img image.Image) (Level, LevelErrors) {
+	var errs LevelErrors
+
+	bounds := img.Bounds()
+	width, height := bounds.Max.X, bounds.Max.Y
+
+	matrix := make(Level, height)
+	for i := range matrix {
+		matrix[i] = make([]Tile, width)
+	}
+
+	// fill matrix based on pixel colors
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+
+			switch {
+			case c == LevelEntityColor_Empty:
+				matrix[y][x] = newTile(LevelEntity_Empty)
+			case c == LevelEntityColor_Wall:
+				matrix[y][x] = newTile(LevelEntity_Wall)
+			case c == LevelEntityColor_Enemy:
+				matrix[y][x] = newTile(LevelEntity_Enemy)
+			case c == LevelEntityColor_Exit:
+				matrix[y][x] = newTile(LevelEntity_Exit)
+			case c == LevelEntityColor_Player:
+				matrix[y][x] = newTile(LevelEntity_Player)
+			case c == LevelEntityColor_Construct:
+				matrix[y][x] = newTile(LevelEntity_Construct)
+			case c == LevelEntityColor_Door:
+				matrix[y][x] = newTile(LevelEntity_Door)
+			case c == LevelEntityColor_Glass:
+				matrix[y][x] = newTile(LevelEntity_Glass)
+			default:
+				matrix[y][x] = newTile(LevelEntity_Empty)
+				errs = append(errs, newLevelError(LevelError_UnknownTile, x, y, fmt.Sprintf("unknown colour #%02x%02x%02x%02x", c.R, c.G, c.B, c.A)))
+			}
+		}
+	}
+
+	return matrix, errs
+}
+
+// finds the player start, validation makes sure there is exactly one
+func (level Level) getPlayer() (float64, float64) {
+	for y := 0; y < len(level); y++ {
+		for x := 0; x < len(level[y]); x++ {
+			if level[y][x].Entity == LevelEntity_Player {
+				// remove player block from level so it doesn't render or collide
+				level[y][x] = newTile(LevelEntity_Empty)
+				return float64(x), float64(y)
+			}
+		}
+	}
+
+	return 0, 0
+}
+
+func (level Level) getEnemies() []Enemy {
+	enemies := []Enemy{}
+	for y := 0; y < len(level); y++ {
+		for x := 0; x < len(level[y]); x++ {
+			if level[y][x].Entity == LevelEntity_Enemy {
+				enemies = append(enemies, Enemy{X: float64(x) + 0.5, Y: float64(y) + 0.5})
+				// remove enemy block from level so it doesn't render or collide
+				level[y][x] = newTile(LevelEntity_Empty)
+			}
+		}
+	}
+	return enemies
+}
+
+func (l Level) Width() int                    { return len(l[0]) }
+func (l Level) Height() int                   { return len(l) }
+func (l Level) EntityAt(x, y int) LevelEntity { return l[y][x].Entity }
+func (l Level) TileAt(x, y int) Tile          { return l[y][x] }
+
+func (l Level) InBounds(x, y int) bool {
+	return x >= 0 && y >= 0 && y < l.Height() && x < l.Width()
+}
@@ -0,0 +1,447 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"strings"
+)
+
+// -- level file
+
+// LevelFile is the on-disk description of a level. the tiles either come from a
+// text grid read through the legend, or are imported from a colour-coded png.
+type LevelFile struct {
+	Name     string                 `json:"name"`
+	ParTime  float64                `json:"parTime"` // seconds
+	Coins    int                    `json:"coins"`   // the player starts with
+	Player   PlayerStart            `json:"player"`
+	Image    string                 `json:"image,omitempty"` // png to import, relative to the level file
+	Tiles    []string               `json:"tiles,omitempty"`
+	Legend   map[string]LegendEntry `json:"legend,omitempty"` // extra or overridden tile characters
+	Enemies  []EnemySpawn           `json:"enemies,omitempty"`
+	Fog      *Fog                   `json:"fog,omitempty"`      // DefaultFog if left out
+	Lighting *Lighting              `json:"lighting,omitempty"` // fully lit everywhere if left out
+	Doors    []DoorSpawn            `json:"doors,omitempty"`
+	Exits    []ExitSpawn            `json:"exits,omitempty"`
+	Pickups  []PickupSpawn          `json:"pickups,omitempty"`
+}
+
+type PlayerStart struct {
+	Direction string `json:"direction"` // north, east, south or west
+}
+
+// Fog fades the view towards a colour with distance, so a dim office can close in
+// around the player while a bright one stays clear to the far wall
+type Fog struct {
+	Color [3]uint8 `json:"color"` // red, green and blue, black for plain darkness
+	Start float64  `json:"start"` // tiles away where the fog begins
+	End   float64  `json:"end"`   // tiles away where nothing but the fog is left
+}
+
+var DefaultFog = Fog{Color: [3]uint8{0, 0, 0}, Start: 6, End: 30}
+
+// Lighting is a level's lamps and the switches that turn them off and on
+type Lighting struct {
+	Ambient  float64      `json:"ambient"` // light everywhere, from 0 for pitch dark to 1 for fully lit
+	Lights   []LightSpawn `json:"lights,omitempty"`
+	Switches [][2]int     `json:"switches,omitempty"` // wall tiles with a light switch on them
+}
+
+type LightSpawn struct {
+	X          int     `json:"x"`
+	Y          int     `json:"y"`
+	Radius     float64 `json:"radius"`               // tiles
+	Brightness float64 `json:"brightness,omitempty"` // 1 if left out
+	Switch     *int    `json:"switch,omitempty"`     // index into the switches, always on if left out
+}
+
+// DoorSpawn describes a door drawn into the tiles. doors with no matching spawn are unlocked
+type DoorSpawn struct {
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Keycard string `json:"keycard,omitempty"` // colour of the keycard that unlocks it
+}
+
+// ExitSpawn describes an exit drawn into the tiles. exits with no matching spawn are unlocked
+type ExitSpawn struct {
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Keycard string `json:"keycard,omitempty"` // colour of the keycard needed to leave through it
+}
+
+// PickupSpawn places an item on the floor of a tile for the player to pick up
+type PickupSpawn struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Type  string `json:"type"`            // keycard, coins or disguise
+	Color string `json:"color,omitempty"` // keycards only
+	Count int    `json:"count,omitempty"` // coins only, 1 if left out
+}
+
+// EnemySpawn places an enemy on a tile. enemies drawn into the tiles with no
+// matching spawn get the default type and a generated patrol route.
+type EnemySpawn struct {
+	X           int      `json:"x"`
+	Y           int      `json:"y"`
+	Type        string   `json:"type,omitempty"`
+	FOVAngle    float64  `json:"fovAngle,omitempty"`    // degrees, overrides the type
+	FOVDistance float64  `json:"fovDistance,omitempty"` // tiles, overrides the type
+	Patrol      [][2]int `json:"patrol,omitempty"`      // tiles to walk between, in order
+}
+
+// LegendEntry is the tile a character in the tiles grid stands for, and any of its
+// properties that differ from the usual ones for that tile. it can be written as just
+// the tile's name when there are none
+type LegendEntry struct {
+	Tile       string   `json:"tile"`
+	Height     *float64 `json:"height,omitempty"` // tiles
+	Solid      *bool    `json:"solid,omitempty"`
+	SeeThrough *bool    `json:"seeThrough,omitempty"`
+}
+
+func (e *LegendEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.Tile); err == nil {
+		return nil
+	}
+	// without its methods, so the object form doesn't come straight back here
+	type legendEntry LegendEntry
+	return json.Unmarshal(data, (*legendEntry)(e))
+}
+
+// the tile the entry stands for, with its overrides applied
+func (e LegendEntry) tile() Tile {
+	tile := newTile(levelEntityNames[e.Tile])
+	if e.Height != nil {
+		tile.Height = *e.Height
+	}
+	if e.Solid != nil {
+		tile.Solid = *e.Solid
+	}
+	if e.SeeThrough != nil {
+		tile.SeeThrough = *e.SeeThrough
+	}
+	return tile
+}
+
+// characters understood in the tiles grid unless the legend says otherwise
+var defaultLegend = map[string]string{
+	".": "empty",
+	" ": "empty",
+	"#": "wall",
+	"C": "construct",
+	"X": "exit",
+	"P": "player",
+	"E": "enemy",
+	"D": "door",
+	"G": "glass",
+}
+
+var levelEntityNames = map[string]LevelEntity{
+	"empty":     LevelEntity_Empty,
+	"wall":      LevelEntity_Wall,
+	"construct": LevelEntity_Construct,
+	"exit":      LevelEntity_Exit,
+	"player":    LevelEntity_Player,
+	"enemy":     LevelEntity_Enemy,
+	"door":      LevelEntity_Door,
+	"glass":     LevelEntity_Glass,
+}
+
+// unit vectors for each start direction, north being up on the minimap
+var playerStartDirections = map[string][2]float64{
+	"north": {0, -1},
+	"east":  {1, 0},
+	"south": {0, 1},
+	"west":  {-1, 0},
+}
+
+func LoadLevelFile(fsys fs.FS, name string) (LevelFile, error) {
+	var levelFile LevelFile
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return levelFile, err
+	}
+	if err := json.Unmarshal(data, &levelFile); err != nil {
+		return levelFile, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := levelFile.check(); err != nil {
+		return levelFile, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return levelFile, nil
+}
+
+// check the metadata makes sense on its own, before any tiles are built
+func (f LevelFile) check() error {
+	if f.Image == "" && len(f.Tiles) == 0 {
+		return fmt.Errorf("level has no tiles, set either \"image\" or \"tiles\"")
+	}
+	if f.Image != "" && len(f.Tiles) > 0 {
+		return fmt.Errorf("level has both \"image\" and \"tiles\", use only one")
+	}
+	if f.Coins < 0 {
+		return fmt.Errorf("coins is %d, must not be negative", f.Coins)
+	}
+	if f.ParTime < 0 {
+		return fmt.Errorf("parTime is %g, must not be negative", f.ParTime)
+	}
+	if f.Player.Direction != "" {
+		if _, ok := playerStartDirections[f.Player.Direction]; !ok {
+			return fmt.Errorf("player direction %q is not one of north, east, south or west", f.Player.Direction)
+		}
+	}
+	for char, entry := range f.Legend {
+		if len([]rune(char)) != 1 {
+			return fmt.Errorf("legend key %q must be a single character", char)
+		}
+		if _, ok := levelEntityNames[entry.Tile]; !ok {
+			return fmt.Errorf("legend maps %q to unknown tile type %q", char, entry.Tile)
+		}
+		if entry.Height != nil && *entry.Height < 0 {
+			return fmt.Errorf("legend %q: height %g must not be negative", char, *entry.Height)
+		}
+	}
+	if f.Fog != nil {
+		if f.Fog.Start < 0 {
+			return fmt.Errorf("fog start is %g, must not be negative", f.Fog.Start)
+		}
+		if f.Fog.End <= f.Fog.Start {
+			return fmt.Errorf("fog end is %g, must be further than its start of %g", f.Fog.End, f.Fog.Start)
+		}
+	}
+	if l := f.Lighting; l != nil {
+		if l.Ambient < 0 || l.Ambient > 1 {
+			return fmt.Errorf("lighting ambient is %g, must be between 0 and 1", l.Ambient)
+		}
+		for i, light := range l.Lights {
+			if light.Radius <= 0 {
+				return fmt.Errorf("light %d: radius %g must be more than 0", i, light.Radius)
+			}
+			if light.Brightness < 0 {
+				return fmt.Errorf("light %d: brightness %g must not be negative", i, light.Brightness)
+			}
+			if light.Switch != nil && (*light.Switch < 0 || *light.Switch >= len(l.Switches)) {
+				return fmt.Errorf("light %d: switch %d doesn't exist, there are %d", i, *light.Switch, len(l.Switches))
+			}
+		}
+	}
+	for i, door := range f.Doors {
+		if _, ok := KeycardColors[door.Keycard]; door.Keycard != "" && !ok {
+			return fmt.Errorf("door %d: unknown keycard colour %q", i, door.Keycard)
+		}
+	}
+	for i, exit := range f.Exits {
+		if _, ok := KeycardColors[exit.Keycard]; exit.Keycard != "" && !ok {
+			return fmt.Errorf("exit %d: unknown keycard colour %q", i, exit.Keycard)
+		}
+	}
+	for i, pickup := range f.Pickups {
+		kind, ok := pickupKindNames[pickup.Type]
+		if !ok {
+			return fmt.Errorf("pickup %d: unknown type %q", i, pickup.Type)
+		}
+		if _, ok := KeycardColors[pickup.Color]; kind == PickupKind_Keycard && !ok {
+			return fmt.Errorf("pickup %d: unknown keycard colour %q", i, pickup.Color)
+		}
+		if pickup.Count < 0 {
+			return fmt.Errorf("pickup %d: count %d must not be negative", i, pickup.Count)
+		}
+	}
+	for i, spawn := range f.Enemies {
+		if spawn.Type != "" {
+			if _, ok := enemyTypes[spawn.Type]; !ok {
+				return fmt.Errorf("enemy %d: unknown type %q", i, spawn.Type)
+			}
+		}
+		if spawn.FOVAngle < 0 || spawn.FOVAngle > 360 {
+			return fmt.Errorf("enemy %d: fovAngle %g must be between 0 and 360 degrees", i, spawn.FOVAngle)
+		}
+		if spawn.FOVDistance < 0 {
+			return fmt.Errorf("enemy %d: fovDistance %g must not be negative", i, spawn.FOVDistance)
+		}
+	}
+	return nil
+}
+
+// build and validate the tile matrix, reading the image relative to the level file's directory.
+// problems with the level's layout are returned together as LevelErrors.
+func (f LevelFile) BuildLevel(fsys fs.FS, name string) (Level, error) {
+	var level Level
+	var errs LevelErrors
+	if f.Image != "" {
+		file, err := fsys.Open(path.Join(path.Dir(name), f.Image))
+		if err != nil {
+			return nil, err
+		}
+
+		level, err = NewLevel(file)
+		if tileErrs, ok := err.(LevelErrors); ok {
+			errs = append(errs, tileErrs...)
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Image, err)
+		}
+	} else {
+		var err error
+		if level, errs, err = f.levelFromTiles(); err != nil {
+			return nil, err
+		}
+	}
+
+	errs = append(errs, level.validate()...)
+	errs = append(errs, f.validateEnemies(level)...)
+	errs = append(errs, f.validateLighting(level)...)
+	errs = append(errs, f.validateDoors(level)...)
+	if len(errs) > 0 {
+		return level, errs
+	}
+
+	return level, nil
+}
+
+// explicit enemies and their patrol routes have to be on tiles they can stand on
+func (f LevelFile) validateEnemies(level Level) LevelErrors {
+	var errs LevelErrors
+	for i, spawn := range f.Enemies {
+		if !level.isWalkable(spawn.X, spawn.Y) {
+			errs = append(errs, newLevelError(LevelError_EnemyInWall, spawn.X, spawn.Y, fmt.Sprintf("enemy %d is not on an open tile", i)))
+		}
+		for j, point := range spawn.Patrol {
+			if !level.isWalkable(point[0], point[1]) {
+				errs = append(errs, newLevelError(LevelError_EnemyInWall, point[0], point[1], fmt.Sprintf("enemy %d patrol point %d is not on an open tile", i, j)))
+			}
+		}
+	}
+	return errs
+}
+
+// lights hang over open tiles and switches are mounted on walls the player can get to
+func (f LevelFile) validateLighting(level Level) LevelErrors {
+	if f.Lighting == nil {
+		return nil
+	}
+
+	var errs LevelErrors
+	for i, light := range f.Lighting.Lights {
+		if !level.InBounds(light.X, light.Y) || level.EntityAt(light.X, light.Y) == LevelEntity_Wall {
+			errs = append(errs, newLevelError(LevelError_LightInWall, light.X, light.Y, fmt.Sprintf("light %d is not over an open tile", i)))
+		}
+	}
+	for i, tile := range f.Lighting.Switches {
+		x, y := tile[0], tile[1]
+		if !level.InBounds(x, y) || level.EntityAt(x, y) != LevelEntity_Wall {
+			errs = append(errs, newLevelError(LevelError_SwitchNotOnWall, x, y, fmt.Sprintf("switch %d is not on a wall", i)))
+			continue
+		}
+		reachable := false
+		for _, n := range pathNeighbours[:4] {
+			reachable = reachable || level.isWalkable(x+n[0], y+n[1])
+		}
+		if !reachable {
+			errs = append(errs, newLevelError(LevelError_SwitchNotOnWall, x, y, fmt.Sprintf("switch %d has no open tile next to it", i)))
+		}
+	}
+	return errs
+}
+
+// door and exit spawns have to describe door and exit tiles, and pickups lie where the
+// player can pick them up
+func (f LevelFile) validateDoors(level Level) LevelErrors {
+	var errs LevelErrors
+	for i, spawn := range f.Doors {
+		if !level.InBounds(spawn.X, spawn.Y) || level.EntityAt(spawn.X, spawn.Y) != LevelEntity_Door {
+			errs = append(errs, newLevelError(LevelError_MisplacedDoor, spawn.X, spawn.Y, fmt.Sprintf("door %d is not on a door tile", i)))
+		}
+	}
+	for i, spawn := range f.Exits {
+		if !level.InBounds(spawn.X, spawn.Y) || level.EntityAt(spawn.X, spawn.Y) != LevelEntity_Exit {
+			errs = append(errs, newLevelError(LevelError_MisplacedExit, spawn.X, spawn.Y, fmt.Sprintf("exit %d is not on an exit tile", i)))
+		}
+	}
+	for i, spawn := range f.Pickups {
+		if !level.isWalkable(spawn.X, spawn.Y) {
+			errs = append(errs, newLevelError(LevelError_PickupInWall, spawn.X, spawn.Y, fmt.Sprintf("%s pickup %d is not on an open tile", spawn.Type, i)))
+		}
+	}
+	return errs
+}
+
+func (f LevelFile) levelFromTiles() (Level, LevelErrors, error) {
+	var errs LevelErrors
+
+	legend := make(map[rune]Tile, len(defaultLegend)+len(f.Legend))
+	for char, name := range defaultLegend {
+		legend[[]rune(char)[0]] = newTile(levelEntityNames[name])
+	}
+	for char, entry := range f.Legend {
+		legend[[]rune(char)[0]] = entry.tile()
+	}
+
+	width := len([]rune(f.Tiles[0]))
+	level := make(Level, len(f.Tiles))
+	for y, row := range f.Tiles {
+		chars := []rune(row)
+		if len(chars) != width {
+			return nil, nil, fmt.Errorf("tiles row %d is %d characters wide, expected %d", y, len(chars), width)
+		}
+
+		level[y] = make([]Tile, width)
+		for x, char := range chars {
+			tile, ok := legend[char]
+			if !ok {
+				tile = newTile(LevelEntity_Empty)
+				errs = append(errs, newLevelError(LevelError_UnknownTile, x, y, fmt.Sprintf("unknown tile %q", char)))
+			}
+			level[y][x] = tile
+		}
+	}
+
+	return level, errs, nil
+}
+
+// combine the enemies drawn into the tiles with the ones described in the file.
+// a spawn on the same tile as a drawn enemy replaces it.
+func (f LevelFile) enemySpawns(level Level) []EnemySpawn {
+	spawns := append([]EnemySpawn{}, f.Enemies...)
+	for _, enemy := range level.getEnemies() {
+		x, y := int(enemy.X), int(enemy.Y)
+		described := false
+		for _, spawn := range f.Enemies {
+			if spawn.X == x && spawn.Y == y {
+				described = true
+				break
+			}
+		}
+		if !described {
+			spawns = append(spawns, EnemySpawn{X: x, Y: y})
+		}
+	}
+	return spawns
+}
+
+func (f LevelFile) DisplayName() string {
+	if f.Name == "" {
+		return "untitled"
+	}
+	return strings.TrimSpace(f.Name)
+}
+
+// the level's fog, or the default for levels that don't set one
+func (f LevelFile) FogSettings() Fog {
+	if f.Fog == nil {
+		return DefaultFog
+	}
+	return *f.Fog
+}
+
+// rotation from the player's default westward facing to the start direction
+func (s PlayerStart) angle() float64 {
+	dir, ok := playerStartDirections[s.Direction]
+	if !ok {
+		return 0
+	}
+	return math.Atan2(dir[1], dir[0]) - math.Atan2(0, -1)
+}
@@ -0,0 +1,58 @@
+package sim
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLegendEntriesOverrideTileProperties(t *testing.T) {
+	var f LevelFile
+	err := json.Unmarshal([]byte(`{
+		"legend": {
+			"w": "wall",
+			"h": {"tile": "wall", "height": 1, "seeThrough": true},
+			"s": {"tile": "wall", "solid": false}
+		},
+		"tiles": ["#whs#"]
+	}`), &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.check(); err != nil {
+		t.Fatal(err)
+	}
+	level := levelFromTestTiles(t, f)
+
+	wall := DefaultTileProperties(LevelEntity_Wall)
+	tests := []struct {
+		x    int
+		want Tile
+	}{
+		{0, Tile{Entity: LevelEntity_Wall, TileProperties: wall}},
+		{1, Tile{Entity: LevelEntity_Wall, TileProperties: wall}},
+		{2, Tile{Entity: LevelEntity_Wall, TileProperties: TileProperties{Height: 1, Solid: true, SeeThrough: true}}},
+		{3, Tile{Entity: LevelEntity_Wall, TileProperties: TileProperties{Height: wall.Height, Solid: false, SeeThrough: false}}},
+	}
+	for _, test := range tests {
+		if got := level.TileAt(test.x, 0); got != test.want {
+			t.Errorf("tile %d is %+v, expected %+v", test.x, got, test.want)
+		}
+	}
+}
+
+func TestCheckRejectsBadLegend(t *testing.T) {
+	for _, legend := range []string{
+		`{"ab": "wall"}`,
+		`{"w": "walll"}`,
+		`{"w": {"tile": "glas"}}`,
+		`{"w": {"tile": "wall", "height": -1}}`,
+	} {
+		var f LevelFile
+		if err := json.Unmarshal([]byte(`{"tiles": ["#"], "legend": `+legend+`}`), &f); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.check(); err == nil {
+			t.Errorf("legend %s passed the check", legend)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package sim
+
+import "math"
+
+// -- lighting
+
+const (
+	lightSampleStep float64 = 0.1  // tiles between the points checked for walls on the way from a light
+	lightDarkSight  float64 = 0.25 // fraction of its sight distance an enemy can still see a player in the dark
+)
+
+// LightMap is how brightly lit each tile is, from 0 for pitch dark to 1 for fully lit
+type LightMap [][]float64
+
+func (m LightMap) At(x, y int) float64 {
+	if y < 0 || y >= len(m) || x < 0 || x >= len(m[y]) {
+		return 0
+	}
+	return m[y][x]
+}
+
+// Light is a lamp lighting the tiles around it that aren't in the shadow of a wall
+type Light struct {
+	X, Y       float64 // tile centre
+	Radius     float64 // tiles the light reaches
+	Brightness float64 // added to its own tile, fading out to nothing at the radius
+	Switch     int     // index into World.Switches, -1 for a light that's always on
+}
+
+// Switch turns a group of lights off and on. it's mounted on a wall tile
+type Switch struct {
+	X, Y int
+	On   bool
+}
+
+// the lights and switches described by the level file, all switched on
+func (f LevelFile) lighting() (float64, []Light, []Switch) {
+	if f.Lighting == nil {
+		return 1, nil, nil
+	}
+
+	lights := make([]Light, len(f.Lighting.Lights))
+	for i, spawn := range f.Lighting.Lights {
+		lights[i] = Light{
+			X:          float64(spawn.X) + 0.5,
+			Y:          float64(spawn.Y) + 0.5,
+			Radius:     spawn.Radius,
+			Brightness: 1,
+			Switch:     -1,
+		}
+		if spawn.Brightness > 0 {
+			lights[i].Brightness = spawn.Brightness
+		}
+		if spawn.Switch != nil {
+			lights[i].Switch = *spawn.Switch
+		}
+	}
+
+	switches := make([]Switch, len(f.Lighting.Switches))
+	for i, tile := range f.Lighting.Switches {
+		switches[i] = Switch{X: tile[0], Y: tile[1], On: true}
+	}
+
+	return f.Lighting.Ambient, lights, switches
+}
+
+func (w *World) isLightOn(l Light) bool {
+	return l.Switch < 0 || w.Switches[l.Switch].On
+}
+
+// index of the switch on a tile, or -1 if there isn't one
+func (w *World) SwitchAt(x, y int) int {
+	for i, s := range w.Switches {
+		if s.X == x && s.Y == y {
+			return i
+		}
+	}
+	return -1
+}
+
+// light every tile with the ambient light and the lights that are on. needed whenever a switch is flipped
+func (w *World) updateLightMap() {
+	if w.LightMap == nil {
+		w.LightMap = make(LightMap, w.Level.Height())
+		for y := range w.LightMap {
+			w.LightMap[y] = make([]float64, w.Level.Width())
+		}
+	}
+
+	for y := range w.LightMap {
+		for x := range w.LightMap[y] {
+			w.LightMap[y][x] = w.ambientLight
+		}
+	}
+
+	for _, light := range w.Lights {
+		if !w.isLightOn(light) {
+			continue
+		}
+
+		reach := int(math.Ceil(light.Radius))
+		lightX, lightY := int(light.X), int(light.Y)
+		for y := lightY - reach; y <= lightY+reach; y++ {
+			for x := lightX - reach; x <= lightX+reach; x++ {
+				if !w.Level.InBounds(x, y) || !w.Level.TileAt(x, y).SeeThrough {
+					continue
+				}
+				dx, dy := float64(x)+0.5-light.X, float64(y)+0.5-light.Y
+				dist := math.Sqrt(dx*dx + dy*dy)
+				if dist >= light.Radius || !w.isLitFrom(light, x, y) {
+					continue
+				}
+				w.LightMap[y][x] += light.Brightness * (1 - dist/light.Radius)
+			}
+		}
+	}
+
+	for y := range w.LightMap {
+		for x := range w.LightMap[y] {
+			w.LightMap[y][x] = math.Min(1, w.LightMap[y][x])
+		}
+	}
+}
+
+// whether a wall, or anything else that can't be seen through, or a closed door stands between
+// a light and the middle of a tile. a closed door is still lit on its own tile, so its panel shows up
+func (w *World) isLitFrom(light Light, x, y int) bool {
+	dx, dy := float64(x)+0.5-light.X, float64(y)+0.5-light.Y
+	steps := int(math.Sqrt(dx*dx+dy*dy) / lightSampleStep)
+	for i := 1; i < steps; i++ {
+		t := float64(i) / float64(steps)
+		tileX, tileY := int(light.X+t*dx), int(light.Y+t*dy)
+		if !w.Level.TileAt(tileX, tileY).SeeThrough {
+			return false
+		}
+		if (tileX != x || tileY != y) && w.isBlockedByDoor(tileX, tileY) {
+			return false
+		}
+	}
+	return true
+}
+
+// how far away an enemy can make out the player, less the darker the player's tile is
+func (w *World) sightDistance(e *Enemy) float64 {
+	light := w.LightMap.At(int(w.Player.X), int(w.Player.Y))
+	return e.FOVDistance * (lightDarkSight + (1-lightDarkSight)*light)
+}
+
+func (w *World) flipSwitch(s *Switch) {
+	s.On = !s.On
+	w.updateLightMap()
+}
@@ -0,0 +1,78 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// a dim corridor split by a wall, with a lamp in the west half on a switch by the player
+func newLightTestWorld(t *testing.T) *World {
+	t.Helper()
+	zero := 0
+	f := LevelFile{
+		Player: PlayerStart{Direction: "north"},
+		Tiles: []string{
+			"##########",
+			"#P...#...#",
+			"##########",
+		},
+		Lighting: &Lighting{
+			Ambient:  0.2,
+			Lights:   []LightSpawn{{X: 2, Y: 1, Radius: 6, Brightness: 0.6, Switch: &zero}},
+			Switches: [][2]int{{1, 0}},
+		},
+	}
+	return NewWorld(f, levelFromTestTiles(t, f), 1)
+}
+
+func TestLightFallsOffAndIsStoppedByWalls(t *testing.T) {
+	w := newLightTestWorld(t)
+	tests := []struct {
+		x    int
+		want float64
+	}{
+		{2, 0.2 + 0.6},
+		{3, 0.2 + 0.6*5/6},
+		{4, 0.2 + 0.6*4/6},
+		{5, 0.2}, // the wall itself
+		{6, 0.2}, // in its shadow
+		{8, 0.2},
+	}
+	for _, test := range tests {
+		if got := w.LightMap.At(test.x, 1); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("tile %d is lit %g, expected %g", test.x, got, test.want)
+		}
+	}
+}
+
+func TestSwitchesTurnLightsOffAndOn(t *testing.T) {
+	w := newLightTestWorld(t)
+
+	w.Step(Input{Interact: true})
+	if w.Switches[0].On {
+		t.Fatal("the switch in front of the player is still on")
+	}
+	if got := w.LightMap.At(3, 1); got != 0.2 {
+		t.Errorf("with the lamp off, the tile next to it is lit %g, expected the ambient 0.2", got)
+	}
+
+	w.Step(Input{Interact: true})
+	if !w.Switches[0].On || w.LightMap.At(3, 1) == 0.2 {
+		t.Error("switching the lamp back on didn't light the tile next to it")
+	}
+}
+
+func TestEnemiesSeeLessFarInTheDark(t *testing.T) {
+	w := newLightTestWorld(t)
+	enemy := &Enemy{FOVDistance: 5}
+
+	w.Player.X = 2.5
+	if got, want := w.sightDistance(enemy), 5*(lightDarkSight+(1-lightDarkSight)*0.8); math.Abs(got-want) > 1e-9 {
+		t.Errorf("sight distance of a player under the lamp is %g, expected %g", got, want)
+	}
+
+	w.Player.X = 7.5
+	if got, want := w.sightDistance(enemy), 5*(lightDarkSight+(1-lightDarkSight)*0.2); math.Abs(got-want) > 1e-9 {
+		t.Errorf("sight distance of a player in the shadow is %g, expected %g", got, want)
+	}
+}
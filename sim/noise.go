@@ -0,0 +1,133 @@
+package sim
+
+import (
+	"container/heap"
+	"math"
+)
+
+// -- noise
+
+const (
+	enemyHearingThreshold float64 = 0.1 // how loud a noise must be, 0 to 1, for an enemy to react
+	noiseWallDamping      float64 = 4   // a solid tile taller than cover, or a closed door, muffles sound as much as this many open tiles
+	footstepInterval      float64 = 0.7 // tiles walked between footsteps
+	footstepNoiseRadius   float64 = 4   // at standing speed, shrinks quickly when moving slower
+	bumpNoiseRadius       float64 = 6
+)
+
+// Noise is a sound made somewhere in the level this tick. it travels through open
+// tiles and gets muffled by walls, getting quieter the further it goes.
+type Noise struct {
+	x, y   float64
+	radius float64
+}
+
+func (w *World) makeNoise(x, y, radius float64) {
+	w.noises = append(w.noises, Noise{x: x, y: y, radius: radius})
+}
+
+// footsteps every so often while walking and a thud when walking into something.
+// crouching is slow enough that footsteps barely carry.
+func (w *World) updatePlayerNoise() {
+	if w.Player.stepDistance >= footstepInterval {
+		w.Player.stepDistance = 0
+		speedRatio := w.Player.speed / playerSpeedStanding
+		w.makeNoise(w.Player.X, w.Player.Y, footstepNoiseRadius*speedRatio*speedRatio)
+	}
+
+	// only the first tick of walking into something makes a noise
+	if w.Player.bumped && !w.Player.isBumping {
+		w.makeNoise(w.Player.X, w.Player.Y, bumpNoiseRadius)
+	}
+	w.Player.isBumping = w.Player.bumped
+	w.Player.bumped = false
+}
+
+// let every enemy hear the noises made this tick, then clear them
+func (w *World) propagateNoises() {
+	for _, noise := range w.noises {
+		loudness := w.propagateNoise(noise)
+		for i := range w.Enemies {
+			enemy := &w.Enemies[i]
+			tileX, tileY := int(enemy.X), int(enemy.Y)
+			if !w.Level.InBounds(tileX, tileY) {
+				continue
+			}
+			if loudness[tileY*w.Level.Width()+tileX] > enemy.hearingThreshold {
+				w.hearNoise(enemy, noise)
+			}
+		}
+	}
+	w.noises = w.noises[:0]
+}
+
+// how loud the noise is on each tile, indexed by y*width+x. loudness falls from 1 at the
+// source to 0 at the noise radius, measured along the quietest route to each tile.
+func (w *World) propagateNoise(noise Noise) []float64 {
+	l := w.Level
+	width := l.Width()
+	loudness := make([]float64, width*l.Height())
+
+	startX, startY := int(noise.x), int(noise.y)
+	if !l.InBounds(startX, startY) || noise.radius <= 0 {
+		return loudness
+	}
+
+	distances := make([]float64, len(loudness))
+	for i := range distances {
+		distances[i] = math.Inf(1)
+	}
+
+	start := startY*width + startX
+	distances[start] = 0
+	open := &pathQueue{{tile: start, priority: 0}}
+
+	for open.Len() > 0 {
+		item := heap.Pop(open).(pathQueueItem)
+		current := item.tile
+		if item.priority > distances[current] {
+			continue
+		}
+		loudness[current] = 1 - distances[current]/noise.radius
+
+		x, y := current%width, current/width
+		for _, n := range pathNeighbours {
+			nx, ny := x+n[0], y+n[1]
+			if !l.InBounds(nx, ny) {
+				continue
+			}
+
+			cost := 1.0
+			if n[0] != 0 && n[1] != 0 {
+				cost = math.Sqrt2
+			}
+			if tile := l.TileAt(nx, ny); (tile.Solid && !tile.isCover()) || w.isBlockedByDoor(nx, ny) {
+				cost *= noiseWallDamping
+			}
+
+			next := ny*width + nx
+			distance := distances[current] + cost
+			if distance < distances[next] && distance < noise.radius {
+				distances[next] = distance
+				heap.Push(open, pathQueueItem{tile: next, priority: distance})
+			}
+		}
+	}
+
+	return loudness
+}
+
+// turn towards the noise and go and look at it, unless already chasing the player
+func (w *World) hearNoise(e *Enemy, noise Noise) {
+	if e.State == EnemyState_Chase {
+		return
+	}
+
+	dx, dy := noise.x-e.X, noise.y-e.Y
+	if dist := math.Sqrt(dx*dx + dy*dy); dist > 0 {
+		e.DirX, e.DirY = dx/dist, dy/dist
+	}
+
+	e.target = PatrolPoint{noise.x, noise.y}
+	e.setState(EnemyState_Investigate)
+}
@@ -0,0 +1,141 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// a corridor with middle on the third tile along, and the player at the far end
+func newNoiseTestWorld(t *testing.T, middle string, enemies ...EnemySpawn) *World {
+	t.Helper()
+	f := LevelFile{
+		Tiles: []string{
+			"##########",
+			"#.......P#",
+			"##########",
+		},
+		Enemies: enemies,
+	}
+	if middle != "" {
+		row := []byte(f.Tiles[1])
+		row[3] = middle[0]
+		f.Tiles[1] = string(row)
+	}
+	return NewWorld(f, levelFromTestTiles(t, f), 1)
+}
+
+func TestNoiseFallsOffWithDistance(t *testing.T) {
+	w := newNoiseTestWorld(t, "")
+	loudness := w.propagateNoise(Noise{x: 1.5, y: 1.5, radius: 4})
+
+	for _, test := range []struct {
+		x    int
+		want float64
+	}{
+		{1, 1},
+		{2, 0.75},
+		{3, 0.5},
+		{5, 0}, // at the radius
+		{7, 0},
+	} {
+		if got := loudness[w.Level.Width()+test.x]; math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%d tiles from the noise it's %g loud, expected %g", test.x-1, got, test.want)
+		}
+	}
+}
+
+func TestSolidTilesMuffleNoise(t *testing.T) {
+	tests := []struct {
+		middle string
+		want   float64
+	}{
+		{".", 1 - 3.0/8},
+		{"#", 1 - (2+noiseWallDamping)/8},
+		{"G", 1 - (2+noiseWallDamping)/8},
+		{"C", 1 - 3.0/8}, // low enough to carry over
+	}
+
+	for _, test := range tests {
+		w := newNoiseTestWorld(t, test.middle)
+		loudness := w.propagateNoise(Noise{x: 1.5, y: 1.5, radius: 8})
+		if got := loudness[w.Level.Width()+4]; math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("past %q the noise is %g loud, expected %g", test.middle, got, test.want)
+		}
+	}
+}
+
+func TestFootstepsGetQuieterWhenCrouching(t *testing.T) {
+	tests := []struct {
+		speed  float64
+		radius float64
+	}{
+		{playerSpeedStanding, footstepNoiseRadius},
+		{playerSpeedCrouching, footstepNoiseRadius * (playerSpeedCrouching / playerSpeedStanding) * (playerSpeedCrouching / playerSpeedStanding)},
+	}
+
+	for _, test := range tests {
+		w := newNoiseTestWorld(t, "")
+		w.Player.speed = test.speed
+
+		// nothing until a whole step has been walked
+		w.Player.stepDistance = footstepInterval / 2
+		w.updatePlayerNoise()
+		if len(w.noises) != 0 {
+			t.Errorf("speed %g: a footstep after half a step", test.speed)
+		}
+
+		w.Player.stepDistance = footstepInterval
+		w.updatePlayerNoise()
+		if len(w.noises) != 1 || math.Abs(w.noises[0].radius-test.radius) > 1e-9 {
+			t.Errorf("speed %g: made noises %+v, expected one footstep with radius %g", test.speed, w.noises, test.radius)
+		}
+		if w.Player.stepDistance != 0 {
+			t.Errorf("speed %g: %g walked since the footstep, expected 0", test.speed, w.Player.stepDistance)
+		}
+	}
+}
+
+func TestWalkingIntoSomethingThudsOnce(t *testing.T) {
+	w := newNoiseTestWorld(t, "")
+	for _, bumped := range []bool{true, true, true, false, true} {
+		w.Player.bumped = bumped
+		w.updatePlayerNoise()
+	}
+	if len(w.noises) != 2 {
+		t.Fatalf("made %d noises walking into a wall twice, expected 2", len(w.noises))
+	}
+	for _, noise := range w.noises {
+		if noise.radius != bumpNoiseRadius {
+			t.Errorf("a thud had radius %g, expected %g", noise.radius, bumpNoiseRadius)
+		}
+	}
+}
+
+func TestEnemiesHearNoisesOverTheirThreshold(t *testing.T) {
+	// four tiles from the noise it's 0.07 loud, enough for security but not for a guard
+	noise := Noise{x: 1.5, y: 1.5, radius: 4.3}
+	tests := []struct {
+		enemyType string
+		hears     bool
+	}{
+		{"guard", false},
+		{"security", true},
+	}
+
+	for _, test := range tests {
+		w := newNoiseTestWorld(t, "", EnemySpawn{X: 5, Y: 1, Type: test.enemyType, Patrol: [][2]int{{5, 1}}})
+		w.noises = append(w.noises, noise)
+		w.propagateNoises()
+
+		enemy := w.Enemies[0]
+		if hears := enemy.State == EnemyState_Investigate; hears != test.hears {
+			t.Errorf("%s: heard is %v, expected %v", test.enemyType, hears, test.hears)
+		}
+		if test.hears && (enemy.DirX != -1 || enemy.target != (PatrolPoint{noise.x, noise.y})) {
+			t.Errorf("%s: facing (%g, %g) to investigate %v, expected to face and investigate the noise", test.enemyType, enemy.DirX, enemy.DirY, enemy.target)
+		}
+		if len(w.noises) != 0 {
+			t.Errorf("%s: %d noises left over after hearing them", test.enemyType, len(w.noises))
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package sim
+
+import (
+	"container/heap"
+	"math"
+)
+
+// -- pathfinding
+
+// maximum number of cached paths before the cache is cleared and starts over
+const pathCacheLimit int = 4096
+
+type pathKey struct {
+	fromX, fromY int
+	toX, toY     int
+}
+
+// PathCache remembers paths between tiles so enemies walking the same routes
+// don't run A* every tick. unreachable goals are cached as nil paths.
+type PathCache struct {
+	level Level
+	paths map[pathKey][]PatrolPoint
+}
+
+func NewPathCache(level Level) *PathCache {
+	return &PathCache{
+		level: level,
+		paths: make(map[pathKey][]PatrolPoint),
+	}
+}
+
+// returns the tile centres to walk through to get from one tile to another, excluding
+// the starting tile. returns nil when the goal can't be reached.
+func (c *PathCache) find(fromX, fromY, toX, toY int) []PatrolPoint {
+	key := pathKey{fromX, fromY, toX, toY}
+	if path, ok := c.paths[key]; ok {
+		return path
+	}
+
+	path := c.level.findPath(fromX, fromY, toX, toY)
+	if len(c.paths) >= pathCacheLimit {
+		c.invalidate()
+	}
+	c.paths[key] = path
+	return path
+}
+
+// forget all cached paths, needed whenever the level layout changes
+func (c *PathCache) invalidate() {
+	c.paths = make(map[pathKey][]PatrolPoint)
+}
+
+func (l Level) isWalkable(x, y int) bool {
+	if !l.InBounds(x, y) {
+		return false
+	}
+	return !l.TileAt(x, y).Solid
+}
+
+var pathNeighbours = [8][2]int{
+	{1, 0}, {-1, 0}, {0, 1}, {0, -1},
+	{1, 1}, {1, -1}, {-1, 1}, {-1, -1},
+}
+
+// a* over the level grid, moving in eight directions without cutting wall corners
+func (l Level) findPath(fromX, fromY, toX, toY int) []PatrolPoint {
+	if !l.isWalkable(toX, toY) || !l.InBounds(fromX, fromY) {
+		return nil
+	}
+
+	width := l.Width()
+	start, goal := fromY*width+fromX, toY*width+toX
+
+	costs := make([]float64, width*l.Height())
+	cameFrom := make([]int, len(costs))
+	closed := make([]bool, len(costs))
+	for i := range costs {
+		costs[i] = math.Inf(1)
+		cameFrom[i] = -1
+	}
+
+	costs[start] = 0
+	open := &pathQueue{{tile: start, priority: octileDistance(fromX, fromY, toX, toY)}}
+
+	for open.Len() > 0 {
+		current := heap.Pop(open).(pathQueueItem).tile
+		if current == goal {
+			return l.reconstructPath(cameFrom, start, goal)
+		}
+		if closed[current] {
+			continue
+		}
+		closed[current] = true
+
+		x, y := current%width, current/width
+		for _, n := range pathNeighbours {
+			nx, ny := x+n[0], y+n[1]
+			if !l.isWalkable(nx, ny) {
+				continue
+			}
+
+			// diagonal moves need both adjacent tiles free so enemies don't clip corners
+			diagonal := n[0] != 0 && n[1] != 0
+			if diagonal && (!l.isWalkable(x+n[0], y) || !l.isWalkable(x, y+n[1])) {
+				continue
+			}
+
+			stepCost := 1.0
+			if diagonal {
+				stepCost = math.Sqrt2
+			}
+
+			next := ny*width + nx
+			cost := costs[current] + stepCost
+			if cost < costs[next] {
+				costs[next] = cost
+				cameFrom[next] = current
+				heap.Push(open, pathQueueItem{tile: next, priority: cost + octileDistance(nx, ny, toX, toY)})
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l Level) reconstructPath(cameFrom []int, start, goal int) []PatrolPoint {
+	width := l.Width()
+	path := []PatrolPoint{}
+	for tile := goal; tile != start; tile = cameFrom[tile] {
+		path = append(path, PatrolPoint{float64(tile%width) + 0.5, float64(tile/width) + 0.5})
+	}
+
+	// walked backwards from the goal, so flip it
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// admissible heuristic for grids with diagonal movement
+func octileDistance(x1, y1, x2, y2 int) float64 {
+	dx := math.Abs(float64(x1 - x2))
+	dy := math.Abs(float64(y1 - y2))
+	return dx + dy + (math.Sqrt2-2)*math.Min(dx, dy)
+}
+
+type pathQueueItem struct {
+	tile     int
+	priority float64
+}
+
+// min-heap of tiles ordered by estimated total cost
+type pathQueue []pathQueueItem
+
+func (q pathQueue) Len() int            { return len(q) }
+func (q pathQueue) Less(i, j int) bool  { return q[i].priority < q[j].priority }
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(pathQueueItem)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
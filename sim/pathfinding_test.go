@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// a level straight from its tiles, without the validation a playable level needs
+func levelFromTestTiles(t *testing.T, f LevelFile) Level {
+	t.Helper()
+	level, errs, err := f.levelFromTiles()
+	if err != nil || len(errs) > 0 {
+		t.Fatalf("building tiles: %v %v", err, errs)
+	}
+	return level
+}
+
+// check a path leads from a tile to another one step at a time, without going through
+// anything solid or cutting a corner
+func checkPath(t *testing.T, level Level, path []PatrolPoint, fromX, fromY, toX, toY int) {
+	t.Helper()
+	if len(path) == 0 {
+		t.Fatalf("no path from (%d, %d) to (%d, %d)", fromX, fromY, toX, toY)
+	}
+
+	x, y := fromX, fromY
+	for _, p := range path {
+		nextX, nextY := int(p.x), int(p.y)
+		dx, dy := nextX-x, nextY-y
+		if math.Abs(float64(dx)) > 1 || math.Abs(float64(dy)) > 1 || (dx == 0 && dy == 0) {
+			t.Fatalf("path jumps from (%d, %d) to (%d, %d)", x, y, nextX, nextY)
+		}
+		if !level.isWalkable(nextX, nextY) {
+			t.Fatalf("path goes through (%d, %d), which isn't walkable", nextX, nextY)
+		}
+		if dx != 0 && dy != 0 && (!level.isWalkable(x+dx, y) || !level.isWalkable(x, y+dy)) {
+			t.Fatalf("path cuts the corner from (%d, %d) to (%d, %d)", x, y, nextX, nextY)
+		}
+		x, y = nextX, nextY
+	}
+	if x != toX || y != toY {
+		t.Fatalf("path ends at (%d, %d), expected (%d, %d)", x, y, toX, toY)
+	}
+}
+
+func TestFindPathAroundObstacles(t *testing.T) {
+	for _, obstacle := range []string{"#", "C", "G"} {
+		t.Run(obstacle, func(t *testing.T) {
+			level := levelFromTestTiles(t, LevelFile{Tiles: []string{
+				"#######",
+				"#.....#",
+				"#" + strings.Repeat(obstacle, 4) + ".#",
+				"#.....#",
+				"#######",
+			}})
+
+			path := level.findPath(1, 1, 1, 3)
+			checkPath(t, level, path, 1, 1, 1, 3)
+
+			// the only way round is through the gap at the end of the row
+			throughGap := false
+			for _, p := range path {
+				throughGap = throughGap || (int(p.x) == 5 && int(p.y) == 2)
+			}
+			if !throughGap {
+				t.Errorf("path %v doesn't go through the gap", path)
+			}
+		})
+	}
+}
+
+func TestFindPathIsShortest(t *testing.T) {
+	level := levelFromTestTiles(t, LevelFile{Tiles: []string{
+		"#######",
+		"#.....#",
+		"#.....#",
+		"#.....#",
+		"#######",
+	}})
+
+	// two straight steps and two diagonal ones
+	path := level.findPath(1, 1, 5, 3)
+	checkPath(t, level, path, 1, 1, 5, 3)
+	if len(path) != 4 {
+		t.Errorf("path has %d steps, expected 4: %v", len(path), path)
+	}
+}
+
+func TestFindPathWithNoWayThrough(t *testing.T) {
+	level := levelFromTestTiles(t, LevelFile{Tiles: []string{
+		"#######",
+		"#.....#",
+		"#CCGG##",
+		"#.....#",
+		"#######",
+	}})
+
+	if path := level.findPath(1, 1, 1, 3); path != nil {
+		t.Errorf("found path %v through a blocked row", path)
+	}
+	if path := level.findPath(1, 1, 2, 2); path != nil {
+		t.Errorf("found path %v onto a construct", path)
+	}
+}
+
+func TestFindPathThroughTilesTheLegendMakesOpen(t *testing.T) {
+	open := false
+	level := levelFromTestTiles(t, LevelFile{
+		Legend: map[string]LegendEntry{"s": {Tile: "wall", Solid: &open}},
+		Tiles: []string{
+			"#######",
+			"#.....#",
+			"####s##",
+			"#.....#",
+			"#######",
+		},
+	})
+
+	path := level.findPath(1, 1, 1, 3)
+	checkPath(t, level, path, 1, 1, 1, 3)
+}
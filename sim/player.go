@@ -0,0 +1,167 @@
+package sim
+
+import "math"
+
+// -- player
+
+const (
+	playerSpeedStanding            float64 = 3   // tiles per second
+	playerSpeedCrouching           float64 = 0.6 // tiles per second
+	playerStandingHeightOffset     float64 = 0.2
+	playerCrouchingHeightOffset    float64 = 0.6
+	playerCrouchingTransitionSpeed float64 = 1.8         // height offset per second
+	playerMaxVerticalAngle         float64 = math.Pi / 3 // 60 degrees
+	interactReach                  float64 = 1.5         // tiles from the player to the middle of a tile they can use
+	interactMaxAngle               float64 = math.Pi / 3 // either side of straight ahead
+)
+
+type Player struct {
+	X, Y           float64
+	DirX, DirY     float64
+	PlaneX, PlaneY float64
+	HeightOffset   float64
+	IsCrouching    bool
+	VerticalAngle  float64
+	Inventory      Inventory
+	speed          float64
+	stepDistance   float64 // distance walked since the last footstep
+	bumped         bool    // walked into something this tick
+	isBumping      bool    // was already walking into something last tick
+}
+
+func NewPlayer(x, y float64) Player {
+	offset := 0.5 // offset to center player in tile
+
+	return Player{
+		X:             x + offset,
+		Y:             y + offset,
+		DirX:          -1,
+		DirY:          0,
+		PlaneX:        0,
+		PlaneY:        0.66,
+		HeightOffset:  playerStandingHeightOffset,
+		IsCrouching:   false,
+		speed:         playerSpeedStanding,
+		VerticalAngle: 0,
+	}
+}
+
+func (w *World) movePlayer(forwardSpeed, strafeSpeed float64) {
+	nextX := w.Player.X + w.Player.DirX*forwardSpeed + w.Player.PlaneX*strafeSpeed
+	nextY := w.Player.Y + w.Player.DirY*forwardSpeed + w.Player.PlaneY*strafeSpeed
+
+	startX, startY := w.Player.X, w.Player.Y
+
+	if !w.playerCollision(nextX, w.Player.Y) {
+		w.Player.X = nextX
+	} else if nextX != w.Player.X {
+		w.Player.bumped = true
+	}
+	if !w.playerCollision(w.Player.X, nextY) {
+		w.Player.Y = nextY
+	} else if nextY != w.Player.Y {
+		w.Player.bumped = true
+	}
+
+	dx, dy := w.Player.X-startX, w.Player.Y-startY
+	w.Player.stepDistance += math.Sqrt(dx*dx + dy*dy)
+}
+
+func (w *World) strafePlayer(speed float64) {
+	w.movePlayer(0, speed)
+}
+
+// turn left and right, and look up and down as far as the clamp allows
+func (w *World) lookPlayer(turn, pitch float64) {
+	w.Player.Rotate(turn)
+
+	w.Player.VerticalAngle += pitch
+	w.Player.VerticalAngle = math.Max(-playerMaxVerticalAngle, math.Min(playerMaxVerticalAngle, w.Player.VerticalAngle))
+}
+
+func (p *Player) Rotate(angle float64) {
+	oldDirX := p.DirX
+	p.DirX = p.DirX*math.Cos(angle) - p.DirY*math.Sin(angle)
+	p.DirY = oldDirX*math.Sin(angle) + p.DirY*math.Cos(angle)
+	oldPlaneX := p.PlaneX
+	p.PlaneX = p.PlaneX*math.Cos(angle) - p.PlaneY*math.Sin(angle)
+	p.PlaneY = oldPlaneX*math.Sin(angle) + p.PlaneY*math.Cos(angle)
+}
+
+func (w *World) adjustPlayerHeightOffset(delta float64) {
+	w.Player.HeightOffset += delta
+	// clamp the height
+	if w.Player.HeightOffset > playerCrouchingHeightOffset {
+		w.Player.HeightOffset = playerCrouchingHeightOffset
+	} else if w.Player.HeightOffset < playerStandingHeightOffset {
+		w.Player.HeightOffset = playerStandingHeightOffset
+	}
+	w.Player.IsCrouching = w.Player.HeightOffset == playerCrouchingHeightOffset
+}
+
+func (w *World) playerCollision(x, y float64) bool {
+	// check position is within level bounds
+	if x < 0 || y < 0 || int(x) >= w.Level.Width() || int(y) >= w.Level.Height() {
+		return true
+	}
+
+	// check position is a solid tile, like a wall, construct or glass
+	if w.Level.TileAt(int(x), int(y)).Solid {
+		return true
+	}
+
+	// doors can only be walked through once they're fully open
+	if w.isBlockedByDoor(int(x), int(y)) {
+		return true
+	}
+
+	// check enemy collision
+	for _, enemy := range w.Enemies {
+		dx := x - enemy.X
+		dy := y - enemy.Y
+		distSquared := dx*dx + dy*dy
+		if distSquared < 0.25 { // collision radius of 0.5
+			w.Outcome = Outcome_Caught // running into an enemy probably alerts them lol
+			return true
+		}
+	}
+
+	return false
+}
+
+// use the nearest switch or door the player is facing and within reach of
+func (w *World) interact() {
+	nearestDist := math.Inf(1)
+	var use func()
+	for i := range w.Switches {
+		s := &w.Switches[i]
+		if dist, ok := w.playerReach(s.X, s.Y); ok && dist < nearestDist {
+			nearestDist, use = dist, func() { w.flipSwitch(s) }
+		}
+	}
+	for i := range w.Doors {
+		d := &w.Doors[i]
+		if dist, ok := w.playerReach(d.X, d.Y); ok && dist < nearestDist {
+			nearestDist, use = dist, func() { w.useDoor(d) }
+		}
+	}
+	if use != nil {
+		use()
+	}
+}
+
+// distance from the player to the middle of a tile, and whether it's close enough and
+// in front of them to be used
+func (w *World) playerReach(x, y int) (float64, bool) {
+	dx, dy := float64(x)+0.5-w.Player.X, float64(y)+0.5-w.Player.Y
+	dist := math.Sqrt(dx*dx + dy*dy)
+	if dist > interactReach {
+		return dist, false
+	}
+	if dist == 0 {
+		return dist, true
+	}
+	dirLength := math.Sqrt(w.Player.DirX*w.Player.DirX + w.Player.DirY*w.Player.DirY)
+	facing := (dx*w.Player.DirX + dy*w.Player.DirY) / (dist * dirLength)
+	return dist, facing >= math.Cos(interactMaxAngle)
+}
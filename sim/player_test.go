@@ -0,0 +1,64 @@
+package sim
+
+import "testing"
+
+func TestPlayerCollision(t *testing.T) {
+	f := LevelFile{Tiles: []string{
+		"#######",
+		"#P.C.X#",
+		"#.#G#.#",
+		"###D###",
+		"#.....#",
+		"#######",
+	}}
+	w := NewWorld(f, levelFromTestTiles(t, f), 1)
+
+	tests := []struct {
+		name    string
+		x, y    float64
+		blocked bool
+	}{
+		{"open floor", 2.5, 1.5, false},
+		{"edge of an open tile", 2.99, 1.01, false},
+		{"the player's own start", 1.5, 1.5, false},
+		{"exit", 5.5, 1.5, false},
+		{"wall", 2.5, 2.5, true},
+		{"construct", 3.5, 1.5, true},
+		{"glass", 3.5, 2.5, true},
+		{"closed door", 3.5, 3.5, true},
+		{"off the west of the level", -0.5, 1.5, true},
+		{"off the south of the level", 1.5, 6.5, true},
+	}
+	for _, test := range tests {
+		if blocked := w.playerCollision(test.x, test.y); blocked != test.blocked {
+			t.Errorf("%s at (%g, %g): blocked is %v, expected %v", test.name, test.x, test.y, blocked, test.blocked)
+		}
+	}
+
+	w.DoorAt(3, 3).Open = 1
+	if w.playerCollision(3.5, 3.5) {
+		t.Error("an open door is in the way")
+	}
+}
+
+func TestPlayerStopsAtGlass(t *testing.T) {
+	f := LevelFile{
+		Player: PlayerStart{Direction: "east"},
+		Tiles: []string{
+			"#######",
+			"#P..GX#",
+			"#######",
+		},
+	}
+	w := NewWorld(f, levelFromTestTiles(t, f), 1)
+
+	for i := 0; i < 5*TickRate; i++ {
+		w.Step(Input{Forward: true})
+	}
+	if w.Player.X >= 4 || w.Player.X < 3.5 {
+		t.Errorf("player walked to x %g, expected to be stopped just short of the glass at 4", w.Player.X)
+	}
+	if w.Outcome != Outcome_Playing {
+		t.Errorf("outcome is %d, the exit is behind the glass", w.Outcome)
+	}
+}
@@ -0,0 +1,249 @@
+package sim
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+)
+
+// -- replay
+
+const (
+	replayMagic   = "OERP"
+	replayVersion = 1 // bump whenever the format or what Checksum hashes changes
+
+	replayMaxLevelLength = 1024
+
+	ReplayChecksumInterval int = 60 // ticks between recorded checksums
+)
+
+// bits of the per-tick flags in a replay file
+const (
+	replayInput_Forward uint64 = 1 << iota
+	replayInput_Backward
+	replayInput_Left
+	replayInput_Right
+	replayInput_Crouch
+	replayInput_Throw
+	replayInput_Turn  // followed by the turn
+	replayInput_Pitch // followed by the pitch
+	replayInput_Interact
+)
+
+// Replay is a run of a level as the seed it started from and the input of every tick,
+// with checksums of the world along the way to notice when playing it back goes differently
+type Replay struct {
+	Level     string // level file path within the game's assets
+	Seed      int64
+	Inputs    []Input
+	Checksums []uint64 // after every ReplayChecksumInterval ticks
+}
+
+func NewReplay(level string, seed int64) *Replay {
+	return &Replay{Level: level, Seed: seed}
+}
+
+// add the input of the tick the world just ran
+func (r *Replay) Record(input Input, w *World) {
+	r.Inputs = append(r.Inputs, input)
+	if w.ElapsedTicks%ReplayChecksumInterval == 0 {
+		r.Checksums = append(r.Checksums, w.Checksum())
+	}
+}
+
+// whether the world still matches the recording after the tick it just ran. ticks with
+// no recorded checksum always match
+func (r *Replay) Matches(w *World) bool {
+	if w.ElapsedTicks%ReplayChecksumInterval != 0 {
+		return true
+	}
+	i := w.ElapsedTicks/ReplayChecksumInterval - 1
+	return i >= len(r.Checksums) || r.Checksums[i] == w.Checksum()
+}
+
+// play the whole recording on a fresh world, returning the first tick it went differently
+// on, or -1 if it never did
+func (r *Replay) Verify(w *World) int {
+	for _, input := range r.Inputs {
+		w.Step(input)
+		if !r.Matches(w) {
+			return w.ElapsedTicks
+		}
+	}
+	return -1
+}
+
+// hash of everything the simulation depends on, to compare runs tick by tick. replays
+// recorded before a change to what's hashed can't be verified, so it needs a new replayVersion
+func (w *World) Checksum() uint64 {
+	h := fnv.New64a()
+	write := func(values ...float64) {
+		for _, v := range values {
+			binary.Write(h, binary.LittleEndian, math.Float64bits(v))
+		}
+	}
+
+	write(float64(w.ElapsedTicks), float64(w.Outcome), w.ThrowCharge)
+	write(w.Player.X, w.Player.Y, w.Player.DirX, w.Player.DirY, w.Player.HeightOffset, w.Player.VerticalAngle)
+	for _, e := range w.Enemies {
+		write(e.X, e.Y, e.DirX, e.DirY, e.Suspicion, float64(e.State))
+	}
+	for _, c := range w.Coins {
+		write(c.X, c.Y, c.Z)
+	}
+	for _, s := range w.Switches {
+		write(boolValue(s.On))
+	}
+	for _, d := range w.Doors {
+		write(d.Open, boolValue(d.Opening), boolValue(d.Keycard != ""))
+	}
+	inventory := w.Player.Inventory
+	write(float64(inventory.Coins), float64(len(inventory.Keycards)), boolValue(inventory.Disguised), float64(len(w.Pickups)))
+	return h.Sum64()
+}
+
+// write the replay gzipped, with uvarint flags per tick and mouse movement only on the ticks that have any
+func (r *Replay) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+
+	bw.WriteString(replayMagic)
+	writeUvarint(bw, replayVersion)
+	writeUvarint(bw, uint64(len(r.Level)))
+	bw.WriteString(r.Level)
+	binary.Write(bw, binary.LittleEndian, r.Seed)
+
+	writeUvarint(bw, uint64(len(r.Inputs)))
+	for _, input := range r.Inputs {
+		writeUvarint(bw, replayInputFlags(input))
+		if input.Turn != 0 {
+			binary.Write(bw, binary.LittleEndian, input.Turn)
+		}
+		if input.Pitch != 0 {
+			binary.Write(bw, binary.LittleEndian, input.Pitch)
+		}
+	}
+
+	writeUvarint(bw, uint64(len(r.Checksums)))
+	for _, checksum := range r.Checksums {
+		binary.Write(bw, binary.LittleEndian, checksum)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func ReadReplay(r io.Reader) (*Replay, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a replay: %w", err)
+	}
+	br := bufio.NewReader(zr)
+
+	magic := make([]byte, len(replayMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != replayMagic {
+		return nil, errors.New("not a replay")
+	}
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if version != replayVersion {
+		return nil, fmt.Errorf("replay version %d is not supported, expected %d", version, replayVersion)
+	}
+
+	replay := &Replay{}
+	levelLength, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if levelLength > replayMaxLevelLength {
+		return nil, errors.New("replay level path is too long")
+	}
+	level := make([]byte, levelLength)
+	if _, err := io.ReadFull(br, level); err != nil {
+		return nil, err
+	}
+	replay.Level = string(level)
+	if err := binary.Read(br, binary.LittleEndian, &replay.Seed); err != nil {
+		return nil, err
+	}
+
+	ticks, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < ticks; i++ {
+		flags, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		input := Input{
+			Forward:  flags&replayInput_Forward != 0,
+			Backward: flags&replayInput_Backward != 0,
+			Left:     flags&replayInput_Left != 0,
+			Right:    flags&replayInput_Right != 0,
+			Crouch:   flags&replayInput_Crouch != 0,
+			Throw:    flags&replayInput_Throw != 0,
+			Interact: flags&replayInput_Interact != 0,
+		}
+		if flags&replayInput_Turn != 0 {
+			if err := binary.Read(br, binary.LittleEndian, &input.Turn); err != nil {
+				return nil, err
+			}
+		}
+		if flags&replayInput_Pitch != 0 {
+			if err := binary.Read(br, binary.LittleEndian, &input.Pitch); err != nil {
+				return nil, err
+			}
+		}
+		replay.Inputs = append(replay.Inputs, input)
+	}
+
+	checksums, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if checksums > ticks/uint64(ReplayChecksumInterval) {
+		return nil, fmt.Errorf("replay has %d checksums for %d ticks", checksums, ticks)
+	}
+	replay.Checksums = make([]uint64, checksums)
+	if err := binary.Read(br, binary.LittleEndian, replay.Checksums); err != nil {
+		return nil, err
+	}
+
+	return replay, nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// in the same order as the replayInput bits
+func replayInputFlags(input Input) uint64 {
+	var flags uint64
+	for i, held := range []bool{input.Forward, input.Backward, input.Left, input.Right, input.Crouch, input.Throw, input.Turn != 0, input.Pitch != 0, input.Interact} {
+		if held {
+			flags |= 1 << i
+		}
+	}
+	return flags
+}
+
+func writeUvarint(w io.ByteWriter, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	for _, b := range buf[:n] {
+		w.WriteByte(b)
+	}
+}
@@ -0,0 +1,81 @@
+package sim
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRunTicks = 800 // long enough to throw coins and draw an enemy through the door, short of getting caught
+
+// record a run of the test level, as the game does while it's played
+func recordTestRun(t *testing.T, seed int64) *Replay {
+	t.Helper()
+	w := newTestWorld(t, testLevelFile(), seed)
+	replay := NewReplay("assets/test.json", seed)
+	for tick := 0; tick < testRunTicks; tick++ {
+		input := testInput(tick)
+		w.Step(input)
+		replay.Record(input, w)
+	}
+	if w.Outcome != Outcome_Playing {
+		t.Fatalf("the test run ended early with outcome %d", w.Outcome)
+	}
+	return replay
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	replay := recordTestRun(t, 42)
+	if want := testRunTicks / ReplayChecksumInterval; len(replay.Checksums) != want {
+		t.Fatalf("recorded %d checksums, expected %d", len(replay.Checksums), want)
+	}
+
+	var buf bytes.Buffer
+	if err := replay.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadReplay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, replay) {
+		t.Fatal("the replay read back differs from the one written")
+	}
+
+	if tick := read.Verify(newTestWorld(t, testLevelFile(), read.Seed)); tick != -1 {
+		t.Errorf("playing the replay back diverged on tick %d", tick)
+	}
+}
+
+func TestReplayVerifyFindsDivergence(t *testing.T) {
+	replay := recordTestRun(t, 42)
+
+	// as if the simulation had gone differently by the fourth checksum
+	replay.Checksums[3]++
+	if tick := replay.Verify(newTestWorld(t, testLevelFile(), replay.Seed)); tick != 4*ReplayChecksumInterval {
+		t.Errorf("tampered replay diverged on tick %d, expected %d", tick, 4*ReplayChecksumInterval)
+	}
+}
+
+func TestReadReplayRejectsOtherFiles(t *testing.T) {
+	if _, err := ReadReplay(strings.NewReader("not gzip at all")); err == nil {
+		t.Error("read a replay from plain text")
+	}
+
+	var buf bytes.Buffer
+	if err := NewReplay("assets/test.json", 1).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	replay, err := ReadReplay(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("empty replay: %v", err)
+	}
+	if len(replay.Inputs) != 0 || replay.Level != "assets/test.json" || replay.Seed != 1 {
+		t.Errorf("empty replay read back as %+v", replay)
+	}
+	if _, err := ReadReplay(bytes.NewReader(data[:len(data)/2])); err == nil {
+		t.Error("read a replay cut off halfway")
+	}
+}
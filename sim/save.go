@@ -0,0 +1,280 @@
+package sim
+
+import "fmt"
+
+// -- saving
+
+// the most random numbers a tick can draw for each enemy, one when it starts a search. it
+// bounds how many draws a save can claim, so a corrupt one can't keep loading forever
+const maxRandomDrawsPerEnemyTick = 1
+
+// WorldSave is everything needed to carry on a run later. it only makes sense with the
+// level file it was saved from, which provides the layout, patrol routes and enemy types
+type WorldSave struct {
+	Seed           int64        `json:"seed"`
+	RandomDraws    uint64       `json:"randomDraws"`
+	ElapsedTicks   int          `json:"elapsedTicks"`
+	CoinsUsed      int          `json:"coinsUsed"`
+	TimesSpotted   int          `json:"timesSpotted"`
+	ThrowCharge    float64      `json:"throwCharge"`
+	PlayerDetected bool         `json:"playerDetected"`
+	Player         PlayerSave   `json:"player"`
+	Enemies        []EnemySave  `json:"enemies"`
+	Coins          []CoinSave   `json:"coins"`
+	SwitchesOn     []bool       `json:"switchesOn"`
+	Doors          []DoorSave   `json:"doors"`
+	Pickups        []PickupSave `json:"pickups"`
+}
+
+type PlayerSave struct {
+	X             float64       `json:"x"`
+	Y             float64       `json:"y"`
+	DirX          float64       `json:"dirX"`
+	DirY          float64       `json:"dirY"`
+	PlaneX        float64       `json:"planeX"`
+	PlaneY        float64       `json:"planeY"`
+	HeightOffset  float64       `json:"heightOffset"`
+	IsCrouching   bool          `json:"isCrouching"`
+	VerticalAngle float64       `json:"verticalAngle"`
+	Speed         float64       `json:"speed"`
+	StepDistance  float64       `json:"stepDistance"`
+	IsBumping     bool          `json:"isBumping"`
+	Inventory     InventorySave `json:"inventory"`
+}
+
+type InventorySave struct {
+	Coins     int      `json:"coins"`
+	Keycards  []string `json:"keycards"`
+	Disguised bool     `json:"disguised"`
+}
+
+type EnemySave struct {
+	X            float64      `json:"x"`
+	Y            float64      `json:"y"`
+	DirX         float64      `json:"dirX"`
+	DirY         float64      `json:"dirY"`
+	CurrentPoint int          `json:"currentPoint"`
+	Suspicion    float64      `json:"suspicion"`
+	State        EnemyState   `json:"state"`
+	StateTicks   int          `json:"stateTicks"`
+	SearchTurn   float64      `json:"searchTurn"`
+	Target       [2]float64   `json:"target"`
+	SearchPoints [][2]float64 `json:"searchPoints"`
+	Path         [][2]float64 `json:"path"`
+	PathGoal     [4]int       `json:"pathGoal"`
+}
+
+type DoorSave struct {
+	Open       float64 `json:"open"`
+	Opening    bool    `json:"opening"`
+	Keycard    string  `json:"keycard"`
+	CloseTicks int     `json:"closeTicks"`
+}
+
+type PickupSave struct {
+	X     float64    `json:"x"`
+	Y     float64    `json:"y"`
+	Kind  PickupKind `json:"kind"`
+	Color string     `json:"color"`
+	Count int        `json:"count"`
+}
+
+type CoinSave struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Z      float64 `json:"z"`
+	VX     float64 `json:"vx"`
+	VY     float64 `json:"vy"`
+	VZ     float64 `json:"vz"`
+	Landed bool    `json:"landed"`
+}
+
+func (w *World) Save() WorldSave {
+	save := WorldSave{
+		Seed:           w.Seed,
+		RandomDraws:    w.source.draws,
+		ElapsedTicks:   w.ElapsedTicks,
+		CoinsUsed:      w.CoinsUsed,
+		TimesSpotted:   w.TimesSpotted,
+		ThrowCharge:    w.ThrowCharge,
+		PlayerDetected: w.PlayerDetected,
+		Player: PlayerSave{
+			X:             w.Player.X,
+			Y:             w.Player.Y,
+			DirX:          w.Player.DirX,
+			DirY:          w.Player.DirY,
+			PlaneX:        w.Player.PlaneX,
+			PlaneY:        w.Player.PlaneY,
+			HeightOffset:  w.Player.HeightOffset,
+			IsCrouching:   w.Player.IsCrouching,
+			VerticalAngle: w.Player.VerticalAngle,
+			Speed:         w.Player.speed,
+			StepDistance:  w.Player.stepDistance,
+			IsBumping:     w.Player.isBumping,
+			Inventory: InventorySave{
+				Coins:     w.Player.Inventory.Coins,
+				Keycards:  append([]string(nil), w.Player.Inventory.Keycards...),
+				Disguised: w.Player.Inventory.Disguised,
+			},
+		},
+	}
+
+	for _, e := range w.Enemies {
+		save.Enemies = append(save.Enemies, EnemySave{
+			X:            e.X,
+			Y:            e.Y,
+			DirX:         e.DirX,
+			DirY:         e.DirY,
+			CurrentPoint: e.currentPoint,
+			Suspicion:    e.Suspicion,
+			State:        e.State,
+			StateTicks:   e.stateTicks,
+			SearchTurn:   e.searchTurn,
+			Target:       [2]float64{e.target.x, e.target.y},
+			SearchPoints: savePoints(e.searchPoints),
+			Path:         savePoints(e.path),
+			PathGoal:     [4]int{e.pathGoal.fromX, e.pathGoal.fromY, e.pathGoal.toX, e.pathGoal.toY},
+		})
+	}
+
+	for _, c := range w.Coins {
+		save.Coins = append(save.Coins, CoinSave{X: c.X, Y: c.Y, Z: c.Z, VX: c.vx, VY: c.vy, VZ: c.vz, Landed: c.Landed})
+	}
+
+	for _, s := range w.Switches {
+		save.SwitchesOn = append(save.SwitchesOn, s.On)
+	}
+
+	for _, d := range w.Doors {
+		save.Doors = append(save.Doors, DoorSave{Open: d.Open, Opening: d.Opening, Keycard: d.Keycard, CloseTicks: d.closeTicks})
+	}
+
+	for _, p := range w.Pickups {
+		save.Pickups = append(save.Pickups, PickupSave{X: p.X, Y: p.Y, Kind: p.Kind, Color: p.Color, Count: p.Count})
+	}
+
+	return save
+}
+
+// RestoreWorld starts the level again and puts everything back where it was when the save was made
+func RestoreWorld(levelFile LevelFile, level Level, save WorldSave) (*World, error) {
+	if save.ElapsedTicks < 0 {
+		return nil, fmt.Errorf("save is %d ticks into the run", save.ElapsedTicks)
+	}
+	for _, e := range save.Enemies {
+		if _, ok := enemyStateSettings[e.State]; !ok {
+			return nil, fmt.Errorf("save has an enemy in unknown state %d", e.State)
+		}
+	}
+	for _, p := range save.Pickups {
+		if p.Kind < PickupKind_Keycard || p.Kind > PickupKind_Disguise {
+			return nil, fmt.Errorf("save has a pickup of unknown kind %d", p.Kind)
+		}
+	}
+
+	w := NewWorld(levelFile, level, save.Seed)
+	if len(save.Enemies) != len(w.Enemies) {
+		return nil, fmt.Errorf("save has %d enemies, the level has %d", len(save.Enemies), len(w.Enemies))
+	}
+	if len(save.SwitchesOn) != len(w.Switches) {
+		return nil, fmt.Errorf("save has %d switches, the level has %d", len(save.SwitchesOn), len(w.Switches))
+	}
+	if len(save.Doors) != len(w.Doors) {
+		return nil, fmt.Errorf("save has %d doors, the level has %d", len(save.Doors), len(w.Doors))
+	}
+	for i, e := range save.Enemies {
+		// an enemy without a patrol route stays on point 0
+		points := len(w.Enemies[i].patrolPoints)
+		if e.CurrentPoint < 0 || (e.CurrentPoint >= points && e.CurrentPoint != 0) {
+			return nil, fmt.Errorf("save has enemy %d heading for patrol point %d of %d", i, e.CurrentPoint, points)
+		}
+	}
+	if maxDraws := uint64(save.ElapsedTicks) * uint64(len(w.Enemies)) * maxRandomDrawsPerEnemyTick; save.RandomDraws > maxDraws {
+		return nil, fmt.Errorf("save has drawn %d random numbers, more than the %d its %d ticks allow", save.RandomDraws, maxDraws, save.ElapsedTicks)
+	}
+
+	for i := uint64(0); i < save.RandomDraws; i++ {
+		w.source.Int63()
+	}
+
+	w.ElapsedTicks = save.ElapsedTicks
+	w.CoinsUsed = save.CoinsUsed
+	w.TimesSpotted = save.TimesSpotted
+	w.ThrowCharge = save.ThrowCharge
+	w.PlayerDetected = save.PlayerDetected
+
+	p := save.Player
+	w.Player.X, w.Player.Y = p.X, p.Y
+	w.Player.DirX, w.Player.DirY = p.DirX, p.DirY
+	w.Player.PlaneX, w.Player.PlaneY = p.PlaneX, p.PlaneY
+	w.Player.HeightOffset = p.HeightOffset
+	w.Player.IsCrouching = p.IsCrouching
+	w.Player.VerticalAngle = p.VerticalAngle
+	w.Player.speed = p.Speed
+	w.Player.stepDistance = p.StepDistance
+	w.Player.isBumping = p.IsBumping
+	w.Player.Inventory = Inventory{
+		Coins:     p.Inventory.Coins,
+		Keycards:  append([]string(nil), p.Inventory.Keycards...),
+		Disguised: p.Inventory.Disguised,
+	}
+
+	for i, e := range save.Enemies {
+		enemy := &w.Enemies[i]
+		// patrol routes and enemy types come from the level file, the state settings on top of them
+		enemy.setState(e.State)
+		enemy.X, enemy.Y = e.X, e.Y
+		enemy.DirX, enemy.DirY = e.DirX, e.DirY
+		enemy.Suspicion = e.Suspicion
+		enemy.stateTicks = e.StateTicks
+		enemy.searchTurn = e.SearchTurn
+		enemy.target = PatrolPoint{e.Target[0], e.Target[1]}
+		enemy.searchPoints = restorePoints(e.SearchPoints)
+		enemy.path = restorePoints(e.Path)
+		enemy.pathGoal = pathKey{e.PathGoal[0], e.PathGoal[1], e.PathGoal[2], e.PathGoal[3]}
+		enemy.currentPoint = e.CurrentPoint
+	}
+
+	for _, c := range save.Coins {
+		w.Coins = append(w.Coins, Coin{X: c.X, Y: c.Y, Z: c.Z, vx: c.VX, vy: c.VY, vz: c.VZ, Landed: c.Landed})
+	}
+
+	for i, on := range save.SwitchesOn {
+		w.Switches[i].On = on
+	}
+	for i, d := range save.Doors {
+		w.Doors[i].Open, w.Doors[i].Opening, w.Doors[i].Keycard = d.Open, d.Opening, d.Keycard
+		w.Doors[i].closeTicks = d.CloseTicks
+	}
+	w.updateLightMap()
+
+	w.Pickups = w.Pickups[:0]
+	for _, p := range save.Pickups {
+		w.Pickups = append(w.Pickups, Pickup{X: p.X, Y: p.Y, Kind: p.Kind, Color: p.Color, Count: p.Count})
+	}
+
+	return w, nil
+}
+
+// nil stays nil, a searching enemy with no points left is different from one that hasn't picked any
+func savePoints(points []PatrolPoint) [][2]float64 {
+	if points == nil {
+		return nil
+	}
+	saved := make([][2]float64, len(points))
+	for i, p := range points {
+		saved[i] = [2]float64{p.x, p.y}
+	}
+	return saved
+}
+
+func restorePoints(saved [][2]float64) []PatrolPoint {
+	if saved == nil {
+		return nil
+	}
+	points := make([]PatrolPoint, len(saved))
+	for i, p := range saved {
+		points[i] = PatrolPoint{p[0], p[1]}
+	}
+	return points
+}
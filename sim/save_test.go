@@ -0,0 +1,88 @@
+package sim
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSaveRestoreKeepsChecksum(t *testing.T) {
+	// save at several points of a run, with a coin in flight at one, an enemy part way along
+	// its path at another and the door sliding open at the first
+	for _, saveTick := range []int{20, 150, 400, 620, testRunTicks - 1} {
+		w := newTestWorld(t, testLevelFile(), 3)
+		w.DoorAt(7, 2).Opening = true
+		for tick := 0; tick < saveTick; tick++ {
+			w.Step(testInput(tick))
+		}
+
+		// through json, as the game stores it
+		data, err := json.Marshal(w.Save())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var save WorldSave
+		if err := json.Unmarshal(data, &save); err != nil {
+			t.Fatal(err)
+		}
+		restored, err := RestoreWorld(testLevelFile(), buildTestLevel(t, testLevelFile()), save)
+		if err != nil {
+			t.Fatalf("tick %d: %v", saveTick, err)
+		}
+		if restored.Checksum() != w.Checksum() {
+			t.Fatalf("tick %d: restored world's checksum differs", saveTick)
+		}
+
+		// and it has to carry on the same, random numbers included
+		for tick := saveTick; tick < saveTick+300; tick++ {
+			w.Step(testInput(tick))
+			restored.Step(testInput(tick))
+			if restored.Checksum() != w.Checksum() {
+				t.Fatalf("saved on tick %d, restored world differs after tick %d", saveTick, w.ElapsedTicks)
+			}
+		}
+	}
+}
+
+func TestRestoreWorldRejectsMismatchedSave(t *testing.T) {
+	w := newTestWorld(t, testLevelFile(), 3)
+
+	save := w.Save()
+	save.Enemies = append(save.Enemies, save.Enemies[0])
+	if _, err := RestoreWorld(testLevelFile(), buildTestLevel(t, testLevelFile()), save); err == nil {
+		t.Error("restored a save with more enemies than the level")
+	}
+
+	save = w.Save()
+	save.Doors = nil
+	if _, err := RestoreWorld(testLevelFile(), buildTestLevel(t, testLevelFile()), save); err == nil {
+		t.Error("restored a save missing the level's doors")
+	}
+
+	save = w.Save()
+	save.Enemies[0].State = EnemyState(99)
+	if _, err := RestoreWorld(testLevelFile(), buildTestLevel(t, testLevelFile()), save); err == nil {
+		t.Error("restored a save with an enemy in an unknown state")
+	}
+
+	for _, point := range []int{-1, len(w.Enemies[0].patrolPoints)} {
+		save = w.Save()
+		save.Enemies[0].CurrentPoint = point
+		if _, err := RestoreWorld(testLevelFile(), buildTestLevel(t, testLevelFile()), save); err == nil {
+			t.Errorf("restored a save with an enemy heading for patrol point %d", point)
+		}
+	}
+
+	save = w.Save()
+	save.ElapsedTicks = -1
+	if _, err := RestoreWorld(testLevelFile(), buildTestLevel(t, testLevelFile()), save); err == nil {
+		t.Error("restored a save from before the run started")
+	}
+
+	// no more than a tick's worth for every enemy, rather than counting up to the corrupt number
+	save = w.Save()
+	save.ElapsedTicks = 10
+	save.RandomDraws = 1 << 62
+	if _, err := RestoreWorld(testLevelFile(), buildTestLevel(t, testLevelFile()), save); err == nil {
+		t.Error("restored a save claiming more random numbers than its ticks could draw")
+	}
+}
@@ -0,0 +1,157 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -- level validation
+
+type LevelErrorKind int
+
+const (
+	LevelError_UnknownTile LevelErrorKind = iota
+	LevelError_MissingPlayer
+	LevelError_DuplicatePlayer
+	LevelError_MissingExit
+	LevelError_UnreachableExit
+	LevelError_EnemyInWall
+	LevelError_OpenEdge
+	LevelError_LightInWall
+	LevelError_SwitchNotOnWall
+	LevelError_MisplacedDoor
+	LevelError_PickupInWall
+	LevelError_MisplacedExit
+)
+
+func (k LevelErrorKind) String() string {
+	switch k {
+	case LevelError_UnknownTile:
+		return "unknown tile"
+	case LevelError_MissingPlayer:
+		return "missing player start"
+	case LevelError_DuplicatePlayer:
+		return "duplicate player start"
+	case LevelError_MissingExit:
+		return "missing exit"
+	case LevelError_UnreachableExit:
+		return "unreachable exit"
+	case LevelError_EnemyInWall:
+		return "enemy inside wall"
+	case LevelError_OpenEdge:
+		return "open edge"
+	case LevelError_LightInWall:
+		return "light inside wall"
+	case LevelError_SwitchNotOnWall:
+		return "switch not on wall"
+	case LevelError_MisplacedDoor:
+		return "misplaced door"
+	case LevelError_PickupInWall:
+		return "pickup inside wall"
+	case LevelError_MisplacedExit:
+		return "misplaced exit"
+	default:
+		return "unknown error"
+	}
+}
+
+// LevelError is one problem with a level's layout, at a tile when X and Y are not negative
+type LevelError struct {
+	Kind    LevelErrorKind
+	X, Y    int
+	Message string
+}
+
+func newLevelError(kind LevelErrorKind, x, y int, message string) LevelError {
+	return LevelError{Kind: kind, X: x, Y: y, Message: message}
+}
+
+func (e LevelError) Error() string {
+	if e.X < 0 || e.Y < 0 {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("(%d, %d): %s: %s", e.X, e.Y, e.Kind, e.Message)
+}
+
+// LevelErrors collects every problem found in a level so they can all be fixed in one go
+type LevelErrors []LevelError
+
+func (errs LevelErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// check the layout is playable: one player start, a reachable exit, doors in doorways and no way out of the map
+func (l Level) validate() LevelErrors {
+	var errs LevelErrors
+
+	var players, exits [][2]int
+	for y := 0; y < l.Height(); y++ {
+		for x := 0; x < l.Width(); x++ {
+			switch l.EntityAt(x, y) {
+			case LevelEntity_Player:
+				players = append(players, [2]int{x, y})
+			case LevelEntity_Exit:
+				exits = append(exits, [2]int{x, y})
+			case LevelEntity_Door:
+				if _, ok := l.doorSide(x, y); !ok {
+					errs = append(errs, newLevelError(LevelError_MisplacedDoor, x, y, "doors need a wall on either side to slide into"))
+				}
+			}
+
+			// only walls stop rays, so anything else on the border lets them walk off the map
+			onEdge := x == 0 || y == 0 || x == l.Width()-1 || y == l.Height()-1
+			if onEdge && l.EntityAt(x, y) != LevelEntity_Wall {
+				errs = append(errs, newLevelError(LevelError_OpenEdge, x, y, "tiles on the edge of the level must be walls"))
+			}
+		}
+	}
+
+	switch {
+	case len(players) == 0:
+		errs = append(errs, newLevelError(LevelError_MissingPlayer, -1, -1, "level has no player start"))
+	case len(players) > 1:
+		for _, p := range players[1:] {
+			errs = append(errs, newLevelError(LevelError_DuplicatePlayer, p[0], p[1], fmt.Sprintf("another player start, the first is at (%d, %d)", players[0][0], players[0][1])))
+		}
+	}
+
+	if len(exits) == 0 {
+		errs = append(errs, newLevelError(LevelError_MissingExit, -1, -1, "level has no exit"))
+	} else if len(players) > 0 && !l.canReachAny(players[0], exits) {
+		errs = append(errs, newLevelError(LevelError_UnreachableExit, players[0][0], players[0][1], "no exit can be reached from the player start"))
+	}
+
+	return errs
+}
+
+// flood fill the walkable tiles from start, looking for any of the goals
+func (l Level) canReachAny(start [2]int, goals [][2]int) bool {
+	visited := make([]bool, l.Width()*l.Height())
+	visited[start[1]*l.Width()+start[0]] = true
+	queue := [][2]int{start}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, goal := range goals {
+			if current == goal {
+				return true
+			}
+		}
+
+		for _, n := range pathNeighbours[:4] {
+			x, y := current[0]+n[0], current[1]+n[1]
+			if l.isWalkable(x, y) && !visited[y*l.Width()+x] {
+				visited[y*l.Width()+x] = true
+				queue = append(queue, [2]int{x, y})
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+package sim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		tiles []string
+		want  []LevelError // kinds and tiles, the messages aren't compared
+	}{
+		{
+			name: "playable",
+			tiles: []string{
+				"######",
+				"#P..X#",
+				"######",
+			},
+		},
+		{
+			name: "missing player",
+			tiles: []string{
+				"######",
+				"#...X#",
+				"######",
+			},
+			want: []LevelError{{Kind: LevelError_MissingPlayer, X: -1, Y: -1}},
+		},
+		{
+			name: "duplicate player",
+			tiles: []string{
+				"######",
+				"#P.PX#",
+				"######",
+			},
+			want: []LevelError{{Kind: LevelError_DuplicatePlayer, X: 3, Y: 1}},
+		},
+		{
+			name: "missing exit",
+			tiles: []string{
+				"######",
+				"#P...#",
+				"######",
+			},
+			want: []LevelError{{Kind: LevelError_MissingExit, X: -1, Y: -1}},
+		},
+		{
+			name: "exit behind a wall",
+			tiles: []string{
+				"######",
+				"#P.#X#",
+				"######",
+			},
+			want: []LevelError{{Kind: LevelError_UnreachableExit, X: 1, Y: 1}},
+		},
+		{
+			name: "exit behind glass",
+			tiles: []string{
+				"######",
+				"#P.GX#",
+				"######",
+			},
+			want: []LevelError{{Kind: LevelError_UnreachableExit, X: 1, Y: 1}},
+		},
+		{
+			name: "open edge",
+			tiles: []string{
+				"######",
+				"#P..X.",
+				"######",
+			},
+			want: []LevelError{{Kind: LevelError_OpenEdge, X: 5, Y: 1}},
+		},
+		{
+			name: "door out of a doorway",
+			tiles: []string{
+				"######",
+				"#P..X#",
+				"#.D..#",
+				"#....#",
+				"######",
+			},
+			want: []LevelError{{Kind: LevelError_MisplacedDoor, X: 2, Y: 2}},
+		},
+		{
+			name: "everything wrong at once",
+			tiles: []string{
+				"#.####",
+				"#..#X#",
+				"######",
+			},
+			want: []LevelError{
+				{Kind: LevelError_OpenEdge, X: 1, Y: 0},
+				{Kind: LevelError_MissingPlayer, X: -1, Y: -1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			level := levelFromTestTiles(t, LevelFile{Tiles: test.tiles})
+			if got := withoutMessages(level.validate()); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, expected %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildLevelReportsLevelFileErrors(t *testing.T) {
+	f := LevelFile{
+		Tiles: []string{
+			"#######",
+			"#P..?X#",
+			"#######",
+		},
+		Enemies: []EnemySpawn{{X: 2, Y: 1, Patrol: [][2]int{{2, 1}, {3, 0}}}},
+		Doors:   []DoorSpawn{{X: 3, Y: 1}},
+		Pickups: []PickupSpawn{{X: 0, Y: 0, Type: "coins"}},
+	}
+
+	_, err := f.BuildLevel(nil, "test")
+	var errs LevelErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %v, expected LevelErrors", err)
+	}
+	want := []LevelError{
+		{Kind: LevelError_UnknownTile, X: 4, Y: 1},
+		{Kind: LevelError_EnemyInWall, X: 3, Y: 0},
+		{Kind: LevelError_MisplacedDoor, X: 3, Y: 1},
+		{Kind: LevelError_PickupInWall, X: 0, Y: 0},
+	}
+	if got := withoutMessages(errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, expected %v", got, want)
+	}
+}
+
+func withoutMessages(errs LevelErrors) []LevelError {
+	var kinds []LevelError
+	for _, err := range errs {
+		kinds = append(kinds, LevelError{Kind: err.Kind, X: err.X, Y: err.Y})
+	}
+	return kinds
+}
@@ -0,0 +1,219 @@
+// Package sim is the game's simulation: the level, the player, enemies and their AI, noise
+// and coins. it has no rendering or input code, so it runs the same with or without a display.
+package sim
+
+import (
+	"math"
+	"math/rand"
+)
+
+// -- world
+
+const (
+	TickRate    int     = 60 // simulation ticks per second, whatever rate the frontend draws at
+	TickSeconds float64 = 1 / float64(TickRate)
+)
+
+type Outcome int
+
+const (
+	Outcome_Playing Outcome = iota
+	Outcome_Caught
+	Outcome_Escaped
+)
+
+// Input is what the player is doing during one tick
+type Input struct {
+	Forward, Backward bool
+	Left, Right       bool
+	Crouch            bool
+	Throw             bool    // held to charge a throw, released to throw
+	Interact          bool    // use a switch or door in front of the player
+	Turn              float64 // radians to rotate the view by
+	Pitch             float64 // radians to look up, negative looks down
+}
+
+// World is one run of a level, advanced a tick at a time by Step. the same seed and
+// inputs always play out the same way.
+type World struct {
+	Seed         int64
+	Level        Level
+	Player       Player
+	Enemies      []Enemy
+	Outcome      Outcome
+	ElapsedTicks int
+	CoinsUsed    int
+	TimesSpotted int
+	ThrowCharge  float64 // 0 to 1, how long the throw key has been held
+
+	Coins          []Coin // flying or lying on the floor
+	PlayerDetected bool   // whether any enemy could see the player on the last tick
+
+	Lights   []Light
+	Switches []Switch
+	LightMap LightMap
+
+	Doors   []Door
+	Pickups []Pickup // lying on the floor
+
+	ambientLight float64
+	doorIndex    map[[2]int]int    // into Doors, by tile
+	exitLocks    map[[2]int]string // keycard colours needed by locked exits, by tile
+
+	rng    *rand.Rand
+	source *randomSource
+	paths  *PathCache
+	noises []Noise
+}
+
+// randomSource counts the numbers it has produced, so a restored world can carry on
+// the sequence from the same point
+type randomSource struct {
+	rand.Source
+	draws uint64
+}
+
+func newRandomSource(seed int64) *randomSource {
+	return &randomSource{Source: rand.NewSource(seed)}
+}
+
+func (s *randomSource) Int63() int64 {
+	s.draws++
+	return s.Source.Int63()
+}
+
+// NewWorld starts a run of a built level, placing the player and enemies described by the level file
+func NewWorld(levelFile LevelFile, level Level, seed int64) *World {
+	playerX, playerY := level.getPlayer()
+	player := NewPlayer(playerX, playerY)
+	player.Rotate(levelFile.Player.angle())
+
+	source := newRandomSource(seed)
+	w := &World{
+		Seed:    seed,
+		rng:     rand.New(source),
+		source:  source,
+		Level:   level,
+		Player:  player,
+		Enemies: make([]Enemy, 0),
+		paths:   NewPathCache(level),
+	}
+	w.Player.Inventory.Coins = levelFile.Coins
+	w.initializeEnemies(levelFile.enemySpawns(level))
+	w.Doors, w.Pickups = levelFile.doors(level), levelFile.pickups()
+	w.doorIndex = make(map[[2]int]int, len(w.Doors))
+	for i, d := range w.Doors {
+		w.doorIndex[[2]int{d.X, d.Y}] = i
+	}
+	w.exitLocks = make(map[[2]int]string)
+	for _, exit := range levelFile.Exits {
+		if exit.Keycard != "" {
+			w.exitLocks[[2]int{exit.X, exit.Y}] = exit.Keycard
+		}
+	}
+	w.ambientLight, w.Lights, w.Switches = levelFile.lighting()
+	w.updateLightMap()
+	return w
+}
+
+// advance the run by one tick. does nothing once the player has been caught or escaped
+func (w *World) Step(input Input) {
+	if w.Outcome != Outcome_Playing {
+		return
+	}
+
+	w.ElapsedTicks++
+
+	w.applyInput(input)
+	if w.Outcome != Outcome_Playing {
+		return
+	}
+
+	// reaching an exit tile wins the level, as long as the player holds any keycard it needs
+	tileX, tileY := int(w.Player.X), int(w.Player.Y)
+	if w.Level.EntityAt(tileX, tileY) == LevelEntity_Exit && w.Player.Inventory.Unlocks(w.ExitKeycard(tileX, tileY)) {
+		w.Outcome = Outcome_Escaped
+		return
+	}
+
+	w.updateDoors()
+	w.updateCoins()
+	w.pickUpItems()
+	w.propagateNoises()
+
+	// update enemies, raising or lowering each one's suspicion before it decides what to do.
+	// the player is caught once any of them is certain
+	playerSeen := false
+	for i := range w.Enemies {
+		enemy := &w.Enemies[i]
+		seesPlayer := w.updateEnemySuspicion(enemy)
+		if seesPlayer {
+			playerSeen = true
+		}
+		w.updateEnemy(enemy, seesPlayer)
+		w.pickUpCoinsNear(enemy)
+
+		// an enemy giving chase has seen through the disguise
+		if enemy.State == EnemyState_Chase {
+			w.Player.Inventory.Disguised = false
+		}
+		if enemy.Suspicion >= 1 {
+			w.Outcome = Outcome_Caught
+		}
+	}
+
+	if playerSeen {
+		if !w.PlayerDetected {
+			w.TimesSpotted++
+		}
+	}
+	w.PlayerDetected = playerSeen
+}
+
+func (w *World) applyInput(input Input) {
+	moveSpeed := w.Player.speed * TickSeconds
+
+	strafeSpeed := moveSpeed * 0.75 // slightly slower strafing
+
+	if input.Forward {
+		w.movePlayer(moveSpeed, 0)
+	}
+	if input.Backward {
+		w.movePlayer(-moveSpeed, 0)
+	}
+	if input.Left {
+		w.strafePlayer(-strafeSpeed)
+	}
+	if input.Right {
+		w.strafePlayer(strafeSpeed)
+	}
+
+	// hold to charge a throw, release to throw
+	if input.Throw {
+		w.ThrowCharge = math.Min(1, w.ThrowCharge+coinThrowChargeSpeed*TickSeconds)
+	} else if w.ThrowCharge > 0 {
+		w.throwCoin()
+		w.ThrowCharge = 0
+	}
+
+	if input.Crouch {
+		w.Player.speed = playerSpeedCrouching
+		w.adjustPlayerHeightOffset(playerCrouchingTransitionSpeed * TickSeconds)
+	} else {
+		w.Player.speed = playerSpeedStanding
+		w.adjustPlayerHeightOffset(-playerCrouchingTransitionSpeed * TickSeconds)
+	}
+
+	w.lookPlayer(input.Turn, input.Pitch)
+
+	if input.Interact {
+		w.interact()
+	}
+
+	w.updatePlayerNoise()
+}
+
+// colour of the keycard the exit on a tile needs, empty if it isn't locked
+func (w *World) ExitKeycard(x, y int) string {
+	return w.exitLocks[[2]int{x, y}]
+}
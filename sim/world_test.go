@@ -0,0 +1,98 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// an office with a bit of everything the simulation has: enemies, cover, glass, a door,
+// a light on a switch and coins to pick up and throw
+func testLevelFile() LevelFile {
+	zero := 0
+	return LevelFile{
+		Name:   "test",
+		Coins:  3,
+		Player: PlayerStart{Direction: "east"},
+		Tiles: []string{
+			"############",
+			"#P.....#...#",
+			"#..C...D..E#",
+			"#......#...#",
+			"#.GG.###.#.#",
+			"#..........#",
+			"#.........X#",
+			"############",
+		},
+		Lighting: &Lighting{
+			Ambient:  0.3,
+			Lights:   []LightSpawn{{X: 4, Y: 2, Radius: 4}, {X: 9, Y: 5, Radius: 3, Switch: &zero}},
+			Switches: [][2]int{{7, 1}},
+		},
+		Pickups: []PickupSpawn{{X: 2, Y: 5, Type: "coins", Count: 2}},
+	}
+}
+
+// a built level, failing the test if it doesn't build. NewWorld takes the player and
+// enemies out of the level, so every world needs a level of its own
+func buildTestLevel(t *testing.T, f LevelFile) Level {
+	t.Helper()
+	level, err := f.BuildLevel(nil, f.Name)
+	if err != nil {
+		t.Fatalf("building level: %v", err)
+	}
+	return level
+}
+
+func newTestWorld(t *testing.T, f LevelFile, seed int64) *World {
+	t.Helper()
+	return NewWorld(f, buildTestLevel(t, f), seed)
+}
+
+// input that walks, turns, crouches, throws and uses things on a fixed pattern, so a run
+// goes through most of what the simulation does
+func testInput(tick int) Input {
+	return Input{
+		Forward:  tick%240 < 150,
+		Left:     tick%300 > 220,
+		Crouch:   tick%500 > 420,
+		Throw:    tick%180 > 140 && tick%180 < 170,
+		Interact: tick%200 == 0,
+		Turn:     0.03 * math.Sin(float64(tick)/40),
+		Pitch:    0.01 * math.Cos(float64(tick)/25),
+	}
+}
+
+func TestStepIsDeterministic(t *testing.T) {
+	f := testLevelFile()
+	a, b := newTestWorld(t, f, 7), newTestWorld(t, f, 7)
+	for tick := 0; tick < 1200; tick++ {
+		a.Step(testInput(tick))
+		b.Step(testInput(tick))
+		if a.Checksum() != b.Checksum() {
+			t.Fatalf("worlds with the same seed and input differ after tick %d", a.ElapsedTicks)
+		}
+	}
+}
+
+func TestStepStopsOnceTheRunIsOver(t *testing.T) {
+	w := newTestWorld(t, testLevelFile(), 1)
+	w.Outcome = Outcome_Caught
+	before := w.Checksum()
+	w.Step(Input{Forward: true, Turn: 0.5})
+	if w.Checksum() != before || w.ElapsedTicks != 0 {
+		t.Errorf("a caught player's world moved on")
+	}
+}
+
+func TestReachingTheExitWins(t *testing.T) {
+	w := newTestWorld(t, testLevelFile(), 1)
+	w.Enemies = nil
+	w.Player.X, w.Player.Y = 9.5, 6.5
+	w.Player.DirX, w.Player.DirY = 1, 0
+	for i := 0; i < 2*TickRate && w.Outcome == Outcome_Playing; i++ {
+		w.Step(Input{Forward: true})
+	}
+	if w.Outcome != Outcome_Escaped {
+		t.Errorf("outcome is %d walking onto the exit, expected %d", w.Outcome, Outcome_Escaped)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"game/sim"
+)
+
+// -- validate subcommand
+
+// the validate subcommand checks level files, or bare level images, and prints every
+// problem found. returns the process exit code.
+func runValidate(paths []string) int {
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: office-escape validate <level.json|level.png>...")
+		return 2
+	}
+
+	exitCode := 0
+	for _, p := range paths {
+		if err := validateLevelPath(p); err != nil {
+			exitCode = 1
+			if errs, ok := err.(sim.LevelErrors); ok {
+				for _, levelErr := range errs {
+					fmt.Printf("%s: %s\n", p, levelErr)
+				}
+			} else {
+				fmt.Printf("%s: %s\n", p, err)
+			}
+			continue
+		}
+		fmt.Printf("%s: ok\n", p)
+	}
+	return exitCode
+}
+
+func validateLevelPath(p string) error {
+	fsys := os.DirFS(filepath.Dir(p))
+	name := filepath.Base(p)
+
+	// a bare image is checked as if a level file imported it
+	if strings.EqualFold(filepath.Ext(name), ".png") {
+		_, err := sim.LevelFile{Image: name}.BuildLevel(fsys, name)
+		return err
+	}
+
+	levelFile, err := sim.LoadLevelFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	_, err = levelFile.BuildLevel(fsys, name)
+	return err
+}